@@ -0,0 +1,3 @@
+module github.com/tjapit/go-learn
+
+go 1.21
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -106,16 +108,19 @@ func main() {
 	doneCh <- struct{}{}
 }
 
+// NOTE: src/logger is the reusable version of this, one Logger per channel
 func logger() {
 	// for entry := range logCh {
 	// 	fmt.Printf("%v - [%v]%v\n", entry.time.Format("2006-01-02T15:04:05"), entry.severity, entry.message)
 	// }
+	// a bare "break" only leaves the select, label the loop to leave both
+Loop:
 	for {
 		select {
 		case entry := <-logCh:
 			fmt.Printf("%v - [%v]%v\n", entry.time.Format("2006-01-02T15:04:05"), entry.severity, entry.message)
 		case <-doneCh:
-			break
+			break Loop
 		}
 	}
 }
@@ -0,0 +1,233 @@
+/* logq filters, follows and counts files written by the logger package,
+ * in any of its formats (text, JSON lines or logfmt).
+ *
+ *	logq -severity warning -since 1h -field route=/ app.log
+ *	logq -f -count app.log        # like tail -f, counts printed on Ctrl-C
+ *
+ * With no files, logq reads stdin.
+ */
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/tjapit/go-learn/src/logger"
+)
+
+// fieldFlags collects repeated -field key=value flags.
+type fieldFlags map[string]string
+
+func (ff fieldFlags) String() string { return fmt.Sprint(map[string]string(ff)) }
+
+func (ff fieldFlags) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	ff[kv[0]] = kv[1]
+	return nil
+}
+
+type filter struct {
+	minSeverity  logger.Severity
+	since, until time.Time
+	fields       fieldFlags
+}
+
+func (f filter) match(rec logger.Record) bool {
+	if rec.Severity < f.minSeverity {
+		return false
+	}
+	if !f.since.IsZero() && rec.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && rec.Time.After(f.until) {
+		return false
+	}
+	for k, v := range f.fields {
+		if rec.Fields[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	f := filter{fields: fieldFlags{}}
+	severity := flag.String("severity", "info", "minimum severity: info, warning or error")
+	since := flag.String("since", "", "only entries at or after this RFC 3339 time, or this long ago (e.g. 15m)")
+	until := flag.String("until", "", "only entries at or before this RFC 3339 time, or this long ago")
+	flag.Var(f.fields, "field", "only entries with this key=value field (repeatable)")
+	follow := flag.Bool("f", false, "keep reading as the files grow, like tail -f")
+	count := flag.Bool("count", false, "print counts per severity when done")
+	flag.Parse()
+
+	var err error
+	if f.minSeverity, err = logger.ParseSeverity(*severity); err != nil {
+		fail(err)
+	}
+	if f.since, err = parseTime(*since); err != nil {
+		fail(err)
+	}
+	if f.until, err = parseTime(*until); err != nil {
+		fail(err)
+	}
+
+	lines := make(chan string)
+	if flag.NArg() == 0 {
+		go func() {
+			readLines(os.Stdin, lines)
+			close(lines)
+		}()
+	} else {
+		go readFiles(flag.Args(), *follow, lines)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	counts := map[logger.Severity]int{}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+Loop:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break Loop
+			}
+			rec, err := logger.ParseLine(line)
+			if err != nil || !f.match(rec) {
+				continue
+			}
+			counts[rec.Severity]++
+			fmt.Fprintln(out, line)
+			// while following, show lines as they come
+			if *follow {
+				out.Flush()
+			}
+		case <-interrupt:
+			break Loop
+		}
+	}
+
+	if *count {
+		for _, sev := range []logger.Severity{logger.LogInfo, logger.LogWarning, logger.LogError} {
+			fmt.Fprintf(out, "%-8v %d\n", sev, counts[sev])
+		}
+	}
+}
+
+// readFiles sends every line of every file down lines, then closes it
+// unless following, in which case it never returns.
+func readFiles(paths []string, follow bool, lines chan<- string) {
+	if !follow {
+		for _, path := range paths {
+			file, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "logq:", err)
+				continue
+			}
+			readLines(file, lines)
+			file.Close()
+		}
+		close(lines)
+		return
+	}
+	for _, path := range paths {
+		go tail(path, lines)
+	}
+}
+
+func readLines(r io.Reader, lines chan<- string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines <- scanner.Text()
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "logq:", err)
+	}
+}
+
+/* tail polls path for new lines. When the file shrinks or is replaced
+ * (i.e. it was rotated) it reads the old one to the end, unterminated last
+ * line included, then starts over from the top of the new one.
+ */
+func tail(path string, lines chan<- string) {
+	var file *os.File
+	var reader *bufio.Reader
+	var offset int64
+	var partial string
+	var old bool // file was rotated away, nothing more will be written to it
+	for {
+		if file == nil {
+			var err error
+			if file, err = os.Open(path); err != nil {
+				time.Sleep(time.Second)
+				continue
+			}
+			reader, offset, partial = bufio.NewReader(file), 0, ""
+		}
+
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		partial += line
+		if err == nil {
+			lines <- strings.TrimSuffix(partial, "\n")
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			fmt.Fprintln(os.Stderr, "logq:", err)
+		}
+		if old {
+			if partial != "" {
+				lines <- partial
+			}
+			file.Close()
+			file, old = nil, false
+			continue
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		// lines may have landed in the old file since the last read
+		old = rotated(file, path, offset)
+	}
+}
+
+func rotated(file *os.File, path string, offset int64) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return true
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		// rotated away and not recreated yet, keep reading the old one
+		return false
+	}
+	return !os.SameFile(opened, current) || current.Size() < offset
+}
+
+// parseTime accepts an RFC 3339 time or a duration meaning that long ago.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "logq:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTailRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 10)
+	go tail(path, lines)
+	next := func() string {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(3 * time.Second):
+			t.Fatal("no line")
+			return ""
+		}
+	}
+	if line := next(); line != "one" {
+		t.Fatalf("got %q, want %q", line, "one")
+	}
+
+	// written to the old file between polls, then rotated away
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("two\nthree")
+	f.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("four\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"two", "three", "four"} {
+		if line := next(); line != want {
+			t.Fatalf("got %q, want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/* Package counters has concurrency-safe versions of IntCounter from
+ * interfaces.go, so nobody has to remember the RWMutex dance around
+ * counter++ from goroutines.go.
+ *
+ * - AtomicCounter: one sync/atomic int64, the default choice
+ * - MutexCounter: a sync.Mutex around an int, simplest to reason about
+ * - ShardedCounter: one atomic per shard, so Goroutines on different
+ *   CPUs rarely touch the same cache line. Meant for counters hammered
+ *   from many cores, slower to read. Not a Counter: its updates don't
+ *   return the new value
+ *
+ * WindowCounter and EWMA count events per time instead of forever.
+ * PersistentCounter keeps its value across restarts.
+ *
+ * The benchmarks in counters_test.go compare them under contention, as
+ * the numbers depend on the machine:
+ *
+ *	go test -bench . -cpu 1,4,8 ./src/counters
+ */
+package counters
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type Incrementer interface {
+	Increment() int
+}
+
+// Counter is an Incrementer with the rest of what callers usually need.
+type Counter interface {
+	Incrementer
+	Add(delta int) int // returns the new value
+	Load() int
+	Reset()
+	Swap(n int) int // returns the old value
+}
+
+// AtomicCounter is ready to use as its zero value.
+type AtomicCounter struct {
+	v int64
+}
+
+func (ac *AtomicCounter) Increment() int    { return ac.Add(1) }
+func (ac *AtomicCounter) Add(delta int) int { return int(atomic.AddInt64(&ac.v, int64(delta))) }
+func (ac *AtomicCounter) Load() int         { return int(atomic.LoadInt64(&ac.v)) }
+func (ac *AtomicCounter) Reset()            { atomic.StoreInt64(&ac.v, 0) }
+func (ac *AtomicCounter) Swap(n int) int    { return int(atomic.SwapInt64(&ac.v, int64(n))) }
+
+// MutexCounter is ready to use as its zero value.
+type MutexCounter struct {
+	mu sync.Mutex
+	v  int
+}
+
+func (mc *MutexCounter) Increment() int { return mc.Add(1) }
+
+func (mc *MutexCounter) Add(delta int) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.v += delta
+	return mc.v
+}
+
+func (mc *MutexCounter) Load() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.v
+}
+
+func (mc *MutexCounter) Reset() { mc.Swap(0) }
+
+func (mc *MutexCounter) Swap(n int) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	old := mc.v
+	mc.v = n
+	return old
+}
+
+// shard fills a whole cache line so neighbouring shards don't contend.
+type shard struct {
+	v int64
+	_ [56]byte
+}
+
+/* ShardedCounter spreads updates over one shard per CPU.
+ *
+ * Go doesn't tell a Goroutine which CPU it's on, but a sync.Pool keeps
+ * one cached item per P, so a shard index kept in one mostly stays with
+ * the same P, and updates from one CPU mostly hit the same shard. That
+ * lookup costs more than an uncontended atomic add, so it only pays off
+ * when many cores update at once.
+ *
+ * Inc and Add don't return the new value, that would mean reading every
+ * shard, so it isn't an Incrementer; call Load when the total is needed.
+ * Swap and Reset aren't atomic with respect to Adds running at the same
+ * time: those land either before or after.
+ */
+type ShardedCounter struct {
+	shards []shard
+	hint   sync.Pool // *int shard index
+	next   uint32    // hands out indexes round-robin to new hints
+}
+
+func NewShardedCounter() *ShardedCounter {
+	sc := &ShardedCounter{shards: make([]shard, runtime.GOMAXPROCS(0))}
+	sc.hint.New = func() interface{} {
+		i := int(atomic.AddUint32(&sc.next, 1)-1) % len(sc.shards)
+		return &i
+	}
+	return sc
+}
+
+func (sc *ShardedCounter) Inc() { sc.Add(1) }
+
+func (sc *ShardedCounter) Add(delta int) {
+	i := sc.hint.Get().(*int)
+	atomic.AddInt64(&sc.shards[*i].v, int64(delta))
+	sc.hint.Put(i)
+}
+
+func (sc *ShardedCounter) Load() int {
+	var total int64
+	for i := range sc.shards {
+		total += atomic.LoadInt64(&sc.shards[i].v)
+	}
+	return int(total)
+}
+
+func (sc *ShardedCounter) Reset() { sc.Swap(0) }
+
+func (sc *ShardedCounter) Swap(n int) int {
+	var old int64
+	for i := range sc.shards {
+		old += atomic.SwapInt64(&sc.shards[i].v, 0)
+	}
+	atomic.AddInt64(&sc.shards[0].v, int64(n))
+	return int(old)
+}
@@ -0,0 +1,107 @@
+package counters
+
+import (
+	"sync"
+	"testing"
+)
+
+// rwMutexCounter is the counter++ pattern from goroutines.go, as a baseline.
+type rwMutexCounter struct {
+	mu sync.RWMutex
+	v  int
+}
+
+func (c *rwMutexCounter) Increment() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.v++
+	return c.v
+}
+
+func (c *rwMutexCounter) Load() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.v
+}
+
+type loadIncrementer interface {
+	Incrementer
+	Load() int
+}
+
+// shardedIncrementer lets ShardedCounter, which returns nothing from Inc,
+// run in the same tests and benchmarks.
+type shardedIncrementer struct {
+	*ShardedCounter
+}
+
+func (si shardedIncrementer) Increment() int {
+	si.Inc()
+	return 0
+}
+
+var impls = []struct {
+	name string
+	new  func() loadIncrementer
+}{
+	{"RWMutex", func() loadIncrementer { return &rwMutexCounter{} }},
+	{"MutexCounter", func() loadIncrementer { return &MutexCounter{} }},
+	{"AtomicCounter", func() loadIncrementer { return &AtomicCounter{} }},
+	{"ShardedCounter", func() loadIncrementer { return shardedIncrementer{NewShardedCounter()} }},
+}
+
+func TestCountersConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 1000
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			c := impl.new()
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						c.Increment()
+					}
+				}()
+			}
+			wg.Wait()
+			if got := c.Load(); got != goroutines*perGoroutine {
+				t.Errorf("Load() = %d, want %d", got, goroutines*perGoroutine)
+			}
+		})
+	}
+}
+
+func BenchmarkIncrement(b *testing.B) {
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			// built here so ShardedCounter sizes itself for this -cpu value
+			c := impl.new()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.Increment()
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixed does 1 read for every 16 increments, like a dashboard
+// polling a hot counter.
+func BenchmarkMixed(b *testing.B) {
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			c := impl.new()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if i%16 == 0 {
+						c.Load()
+					} else {
+						c.Increment()
+					}
+				}
+			})
+		})
+	}
+}
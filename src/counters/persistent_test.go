@@ -0,0 +1,179 @@
+package counters
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// a small snapshot interval so kills land in snapshots too
+const crashSnapshotEvery = 7
+
+// crashChildEnv tells the test binary it's the child of
+// TestPersistentCounterCrash, and which file to count in.
+const crashChildEnv = "COUNTERS_CRASH_CHILD"
+
+func TestPersistentCounterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seq")
+	pc, err := OpenPersistentCounter(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		if n, err := pc.Next(); err != nil || n != i {
+			t.Fatalf("Next() = %d, %v, want %d", n, err, i)
+		}
+	}
+	if err := pc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.Next(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Next after Close: %v, want ErrClosed", err)
+	}
+
+	pc, err = OpenPersistentCounter(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if got := pc.Load(); got != 10 {
+		t.Errorf("reopened at %d, want 10", got)
+	}
+}
+
+func TestPersistentCounterCorruptSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seq")
+	if err := os.WriteFile(path, []byte("not a snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenPersistentCounter(path, 0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("got %v, want ErrCorrupt", err)
+	}
+}
+
+/* TestPersistentCounterCrash runs the test binary again as a child that
+ * hands out numbers as fast as it can, SIGKILLs it at a random moment,
+ * reopens the counter and checks no number the child printed is lost or
+ * handed out again. Every other round it also tears the end of the log
+ * the way a crash in the middle of a write would.
+ */
+func TestPersistentCounterCrash(t *testing.T) {
+	rounds := 20
+	if testing.Short() {
+		rounds = 4
+	}
+	path := filepath.Join(t.TempDir(), "seq")
+
+	restored := 0
+	for round := 1; round <= rounds; round++ {
+		first, last, printed := killChild(t, path)
+		if printed > 0 && first != restored+1 {
+			t.Fatalf("round %d: child started at %d, want %d", round, first, restored+1)
+		}
+
+		if round%2 == 0 {
+			tearLog(t, path)
+		}
+
+		pc, err := OpenPersistentCounter(path, crashSnapshotEvery)
+		if err != nil {
+			t.Fatalf("round %d: reopen: %v", round, err)
+		}
+		got := pc.Load()
+		// the child may die after persisting a number but before printing it
+		if got < last || got > last+1 {
+			t.Fatalf("round %d: restored %d, last printed %d", round, got, last)
+		}
+		if err := pc.Close(); err != nil {
+			t.Fatalf("round %d: close: %v", round, err)
+		}
+		restored = got
+	}
+}
+
+// TestPersistentCounterCrashChild is the child, it does nothing in a
+// normal test run.
+func TestPersistentCounterCrashChild(t *testing.T) {
+	path := os.Getenv(crashChildEnv)
+	if path == "" {
+		t.Skip("only runs as TestPersistentCounterCrash's child")
+	}
+	pc, err := OpenPersistentCounter(path, crashSnapshotEvery)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for {
+		n, err := pc.Next()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// printed only once durable, so every printed number must survive
+		fmt.Fprintln(w, n)
+		w.Flush()
+	}
+}
+
+// killChild starts a child, kills it after a random moment and returns the
+// first and last numbers it printed.
+func killChild(t *testing.T, path string) (first, last, printed int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPersistentCounterCrashChild$")
+	cmd.Env = append(os.Environ(), crashChildEnv+"="+path)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// a line without its newline was cut off by the kill, so it doesn't count
+		sc := bufio.NewScanner(out)
+		for sc.Scan() {
+			n, err := strconv.Atoi(sc.Text())
+			if err != nil {
+				continue
+			}
+			if printed == 0 {
+				first = n
+			}
+			last = n
+			printed++
+		}
+	}()
+
+	time.Sleep(time.Duration(20+rand.Intn(80)) * time.Millisecond)
+	cmd.Process.Kill()
+	<-done
+	cmd.Wait()
+	return first, last, printed
+}
+
+// tearLog appends part of a record, as if the process died mid-write.
+func tearLog(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	garbage := make([]byte, 1+rand.Intn(recordSize-1))
+	rand.Read(garbage)
+	if _, err := f.Write(garbage); err != nil {
+		t.Fatal(err)
+	}
+}
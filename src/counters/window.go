@@ -0,0 +1,248 @@
+package counters
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* WindowCounter counts events in a sliding window, unlike the counter in
+ * goroutines.go which only ever grows. Time is cut into buckets of one
+ * resolution each; buckets older than the window are forgotten. One
+ * counter answers for any span up to its window, to within a bucket:
+ *
+ *	hits := counters.NewWindowCounter(5*time.Minute, time.Second)
+ *	hits.Increment()
+ *	hits.CountOver(time.Second) // last 1s
+ *	hits.CountOver(time.Minute) // last 1m
+ *	hits.Count()                // last 5m
+ *
+ * and the same counter is a sliding window rate limiter:
+ *
+ *	if !hits.Allow(time.Second, 100) {
+ *		http.Error(w, "slow down", http.StatusTooManyRequests)
+ *	}
+ */
+type WindowCounter struct {
+	mu         sync.Mutex
+	buckets    []int
+	resolution time.Duration
+	head       int       // bucket for the current period
+	headStart  time.Time // start of the current period
+	now        func() time.Time
+}
+
+// NewWindowCounter remembers window, rounded up to a whole number of
+// resolution-sized buckets.
+func NewWindowCounter(window, resolution time.Duration) *WindowCounter {
+	if resolution <= 0 {
+		resolution = time.Second
+	}
+	n := int((window + resolution - 1) / resolution)
+	if n < 1 {
+		n = 1
+	}
+	wc := &WindowCounter{buckets: make([]int, n), resolution: resolution, now: time.Now}
+	wc.headStart = wc.now().Truncate(resolution)
+	return wc
+}
+
+// Increment returns the count over the whole window, this event included.
+func (wc *WindowCounter) Increment() int { return wc.Add(1) }
+
+// Add returns the count over the whole window.
+func (wc *WindowCounter) Add(delta int) int {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.advance()
+	wc.buckets[wc.head] += delta
+	return wc.sum(len(wc.buckets))
+}
+
+// Count is the number of events in the whole window.
+func (wc *WindowCounter) Count() int {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.advance()
+	return wc.sum(len(wc.buckets))
+}
+
+// CountOver is the number of events in the last d, counting the current,
+// partly elapsed bucket as a whole one. d is capped at the window.
+func (wc *WindowCounter) CountOver(d time.Duration) int {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.advance()
+	return wc.sum(wc.span(d))
+}
+
+// Rate is CountOver(d) per second.
+func (wc *WindowCounter) Rate(d time.Duration) float64 {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.advance()
+	n := wc.span(d)
+	return float64(wc.sum(n)) / (time.Duration(n) * wc.resolution).Seconds()
+}
+
+// Allow counts an event and reports true if fewer than limit happened in
+// the last d, else it reports false and counts nothing. Checking and
+// counting happen under one lock, so concurrent callers can't overshoot.
+func (wc *WindowCounter) Allow(d time.Duration, limit int) bool {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.advance()
+	if wc.sum(wc.span(d)) >= limit {
+		return false
+	}
+	wc.buckets[wc.head]++
+	return true
+}
+
+func (wc *WindowCounter) Reset() {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	for i := range wc.buckets {
+		wc.buckets[i] = 0
+	}
+	wc.headStart = wc.now().Truncate(wc.resolution)
+}
+
+// advance moves head to the current period, zeroing the buckets it passes.
+func (wc *WindowCounter) advance() {
+	elapsed := wc.now().Sub(wc.headStart)
+	if elapsed < wc.resolution {
+		return
+	}
+	steps := int(elapsed / wc.resolution)
+	wc.headStart = wc.headStart.Add(time.Duration(steps) * wc.resolution)
+	if steps >= len(wc.buckets) {
+		for i := range wc.buckets {
+			wc.buckets[i] = 0
+		}
+		return
+	}
+	for ; steps > 0; steps-- {
+		wc.head = (wc.head + 1) % len(wc.buckets)
+		wc.buckets[wc.head] = 0
+	}
+}
+
+// span is how many buckets, the current one included, cover d.
+func (wc *WindowCounter) span(d time.Duration) int {
+	n := int((d + wc.resolution - 1) / wc.resolution)
+	if n < 1 {
+		n = 1
+	}
+	if n > len(wc.buckets) {
+		n = len(wc.buckets)
+	}
+	return n
+}
+
+// sum adds up the newest n buckets.
+func (wc *WindowCounter) sum(n int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		total += wc.buckets[(wc.head-i+len(wc.buckets))%len(wc.buckets)]
+	}
+	return total
+}
+
+// DefaultTick is how often an EWMA folds new events into its rate.
+const DefaultTick = 5 * time.Second
+
+/* EWMA is an exponentially-weighted moving rate, in events per second,
+ * like the 1, 5 and 15 minute load averages of uptime. Recent events
+ * weigh most and old ones fade, so it reacts smoothly instead of jumping
+ * when a bucket falls out of a window:
+ *
+ *	m1 := counters.NewEWMA(time.Minute)
+ *	m1.Increment()
+ *	m1.Rate()
+ *
+ * Increments are a single atomic add; the rate is recomputed once per
+ * tick, by whichever caller notices the tick is due.
+ */
+type EWMA struct {
+	pending  int64 // events since the last tick
+	nextTick int64 // UnixNano, lets Add skip the lock between ticks
+
+	mu    sync.Mutex
+	alpha float64
+	tick  time.Duration
+	rate  float64 // per tick
+	ready bool    // false until the first tick set rate
+	last  time.Time
+	now   func() time.Time
+}
+
+// NewEWMA makes an EWMA whose events fade with the time constant window,
+// ticking every DefaultTick.
+func NewEWMA(window time.Duration) *EWMA {
+	return NewEWMATick(window, DefaultTick)
+}
+
+// NewEWMATick is NewEWMA with its own tick, for windows near or below
+// DefaultTick.
+func NewEWMATick(window, tick time.Duration) *EWMA {
+	if tick <= 0 {
+		tick = DefaultTick
+	}
+	if window < tick {
+		window = tick
+	}
+	e := &EWMA{
+		alpha: 1 - math.Exp(-tick.Seconds()/window.Seconds()),
+		tick:  tick,
+		now:   time.Now,
+	}
+	e.last = e.now()
+	e.nextTick = e.last.Add(tick).UnixNano()
+	return e
+}
+
+// Increment returns the number of events since the last tick, which is
+// all an EWMA can say without taking its lock.
+func (e *EWMA) Increment() int { return e.Add(1) }
+
+func (e *EWMA) Add(delta int) int {
+	n := atomic.AddInt64(&e.pending, int64(delta))
+	if e.now().UnixNano() >= atomic.LoadInt64(&e.nextTick) {
+		e.mu.Lock()
+		e.advance()
+		e.mu.Unlock()
+	}
+	return int(n)
+}
+
+// Rate is the moving rate in events per second, as of the last tick.
+func (e *EWMA) Rate() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.advance()
+	return e.rate / e.tick.Seconds()
+}
+
+// advance applies every tick that's due. Events from the whole gap land
+// in the first one, so callers that go quiet for a while should still
+// Rate now and then to keep it precise.
+func (e *EWMA) advance() {
+	elapsed := e.now().Sub(e.last)
+	if elapsed < e.tick {
+		return
+	}
+	ticks := int(elapsed / e.tick)
+	e.last = e.last.Add(time.Duration(ticks) * e.tick)
+	atomic.StoreInt64(&e.nextTick, e.last.Add(e.tick).UnixNano())
+
+	count := float64(atomic.SwapInt64(&e.pending, 0))
+	if e.ready {
+		e.rate += e.alpha * (count - e.rate)
+	} else {
+		e.rate, e.ready = count, true
+	}
+	// no events in the remaining ticks, the rate only decays
+	e.rate *= math.Pow(1-e.alpha, float64(ticks-1))
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -150,6 +152,7 @@ type WriterCloser interface {
 	Closer
 }
 
+// NOTE: src/writers has a configurable version writing to any downstream Writer
 type BufferedWriterCloser struct {
 	buffer *bytes.Buffer
 }
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// ctxKey is unexported so no other package can collide with it.
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the Logger stored by NewContext, or a Logger that
+// discards everything, so callers never have to check.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok && l != nil {
+		return l
+	}
+	return &Logger{}
+}
+
+// RequestIDHeader is read for an incoming request ID and echoed back.
+const RequestIDHeader = "X-Request-ID"
+
+/* Middleware gives every request a child of l tagged with its request ID
+ * and route, reachable from handlers with FromContext(r.Context()), and
+ * logs one line per request once it's served. E.g. for the server in
+ * controlFlow/panic.go:
+ *
+ *	http.Handle("/", logger.Middleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+ *		logger.FromContext(r.Context()).Info("saying hi")
+ *		w.Write([]byte("Oh hi"))
+ *	})))
+ */
+func Middleware(l *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		reqLog := l.With(
+			String("request_id", id),
+			String("method", r.Method),
+			String("route", r.URL.Path),
+		)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), reqLog)))
+		reqLog.Info("request served", Int("status", sw.status), Duration("duration", time.Since(start)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusWriter remembers the status code the handler wrote.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(data []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(data)
+}
+
+// Flush keeps streaming handlers working through the wrapper.
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+/* Format picks how a Sink renders an entry.
+ *
+ * TextFormat is the original "time - [SEVERITY]message" line with fields
+ * appended as key=value. JSONFormat writes one JSON object per line and
+ * LogfmtFormat writes key=value pairs, both readable without regexes:
+ *
+ *	{"time":"2021-06-01T10:00:00.5Z","severity":"INFO","message":"hi","user":"tim"}
+ *	time=2021-06-01T10:00:00.5Z severity=INFO message=hi user=tim
+ */
+type Format int
+
+const (
+	TextFormat Format = iota
+	JSONFormat
+	LogfmtFormat
+	numFormats
+)
+
+const (
+	textTimeLayout = "2006-01-02T15:04:05"
+	// structured formats keep the sub-second part and the zone
+	structuredTimeLayout = time.RFC3339Nano
+)
+
+func encode(format Format, entry logEntry) []byte {
+	switch format {
+	case JSONFormat:
+		return encodeJSON(entry)
+	case LogfmtFormat:
+		return encodeLogfmt(entry)
+	}
+	return encodeText(entry)
+}
+
+func encodeText(entry logEntry) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%v - [%v]%v", entry.time.Format(textTimeLayout), entry.severity, entry.message)
+	for _, f := range entry.fields {
+		b.WriteByte(' ')
+		appendLogfmtPair(&b, f.Key, f.Value)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func encodeLogfmt(entry logEntry) []byte {
+	var b bytes.Buffer
+	appendLogfmtPair(&b, "time", entry.time.Format(structuredTimeLayout))
+	b.WriteByte(' ')
+	appendLogfmtPair(&b, "severity", entry.severity.String())
+	b.WriteByte(' ')
+	appendLogfmtPair(&b, "message", entry.message)
+	for _, f := range entry.fields {
+		b.WriteByte(' ')
+		appendLogfmtPair(&b, fieldKey(f.Key), f.Value)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func encodeJSON(entry logEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	appendJSON(&b, entry.time.Format(structuredTimeLayout))
+	b.WriteString(`,"severity":`)
+	appendJSON(&b, entry.severity.String())
+	b.WriteString(`,"message":`)
+	appendJSON(&b, entry.message)
+	for _, f := range entry.fields {
+		b.WriteByte(',')
+		appendJSON(&b, fieldKey(f.Key))
+		b.WriteByte(':')
+		appendJSON(&b, plainValue(f.Value))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// fieldKey keeps a field from shadowing the keys every entry already has.
+func fieldKey(key string) string {
+	switch key {
+	case "time", "severity", "message":
+		return "field." + key
+	}
+	return key
+}
+
+// plainValue turns the types with no useful JSON form into strings.
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(structuredTimeLayout)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func appendJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// values json can't handle (channels, funcs, cycles) still get logged
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+func appendLogfmtPair(b *bytes.Buffer, key string, v interface{}) {
+	b.WriteString(key)
+	b.WriteByte('=')
+	var s string
+	switch v := plainValue(v).(type) {
+	case string:
+		s = v
+	case nil:
+		s = "null"
+	default:
+		s = fmt.Sprint(v)
+	}
+	if needsQuoting(s) {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
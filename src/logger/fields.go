@@ -0,0 +1,28 @@
+package logger
+
+import "time"
+
+/* Field is a typed key/value pair attached to an entry, e.g.
+ *
+ *	l.Info("request served", logger.String("route", "/"), logger.Int("status", 200))
+ *
+ * The constructors keep call sites typed, Value is whatever they stored.
+ */
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, val string) Field                 { return Field{key, val} }
+func Int(key string, val int) Field                { return Field{key, val} }
+func Int64(key string, val int64) Field            { return Field{key, val} }
+func Float64(key string, val float64) Field        { return Field{key, val} }
+func Bool(key string, val bool) Field              { return Field{key, val} }
+func Duration(key string, val time.Duration) Field { return Field{key, val} }
+func Time(key string, val time.Time) Field         { return Field{key, val} }
+
+// Any stores val as is, JSON encodes it with encoding/json.
+func Any(key string, val interface{}) Field { return Field{key, val} }
+
+// Err stores err under the "error" key.
+func Err(err error) Field { return Field{"error", err} }
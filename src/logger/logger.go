@@ -0,0 +1,405 @@
+/* Package logger is the channel-based logger from channels.go pulled out
+ * into something importable.
+ *
+ * Every Logger owns its own buffered entry channel, done signal and the
+ * Goroutine draining them, so several independent loggers can run in the
+ * same process without sharing any package-level state.
+ *
+ *	l := logger.New()
+ *	defer l.Close()
+ *	l.Info("App is starting")
+ *
+ * Shutdown is lossless: Close and Shutdown write every entry still sitting
+ * in the channel before returning, instead of sleeping and hoping.
+ *
+ * Entries fan out to any number of Sinks, each with its own minimum
+ * severity:
+ *
+ *	errs, _ := logger.File("errors.log", logger.LogError)
+ *	l := logger.New(logger.WithSinks(logger.Console(logger.LogInfo), errs))
+ *
+ * and may carry typed fields, rendered as text, JSON lines or logfmt
+ * depending on the Sink's Format:
+ *
+ *	l.Error("payment failed", logger.String("order", id), logger.Err(err))
+ *
+ * RotatingFile rolls a file over by size (in units.KB/MB/GB) or daily, and
+ * SyslogWriter ships RFC 5424 frames over UDP, TCP or a Unix socket.
+ *
+ * With makes child Loggers that add fields to every entry, and NewContext
+ * / FromContext carry one through a context.Context, e.g. per HTTP request
+ * with Middleware.
+ *
+ * When a burst fills the channel, WithBuffer's OverflowPolicy decides
+ * whether callers block, entries are dropped or they spill to disk, and
+ * WithSampling keeps storms of identical entries from filling it at all.
+ */
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Severity ranks a log entry, from least to most severe.
+type Severity int
+
+const (
+	LogInfo Severity = iota
+	LogWarning
+	LogError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case LogInfo:
+		return "INFO"
+	case LogWarning:
+		return "WARNING"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ErrClosed is returned by Flush once the Logger has been shut down.
+var ErrClosed = errors.New("logger: closed")
+
+type logEntry struct {
+	time     time.Time
+	severity Severity
+	message  string
+	fields   []Field
+}
+
+/* Logger writes entries from its channel on a Goroutine it owns.
+ *
+ * Loggers made by With share that channel, Goroutine and sinks with their
+ * parent and only add fields, so shutting any of them down shuts down the
+ * whole family. The zero Logger (and a nil *Logger) discards everything.
+ */
+type Logger struct {
+	*core
+	fields []Field
+}
+
+// core is what a Logger and all of its With children share.
+type core struct {
+	// first in the struct so they're 64-bit aligned for sync/atomic
+	dropped uint64
+	spilled uint64
+
+	logCh     chan logEntry
+	doneCh    chan struct{} // 0 memory allocation to send signals (empty struct)
+	flushCh   chan chan struct{}
+	stoppedCh chan struct{}
+
+	/* mu guards closed. Senders hold the read lock while sending so that
+	 * run, which takes the write lock after doneCh is closed, knows nothing
+	 * else can land in logCh once it has set closed. Shutdown itself never
+	 * waits on it, a sender blocked on a full logCh would hold it up.
+	 */
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+
+	sinks    []Sink
+	onError  func(error)
+	closeErr error // set by run before stoppedCh is closed
+
+	bufferSize int
+	overflow   OverflowPolicy
+	spillPath  string
+	spill      *spillQueue
+	spillCh    chan struct{}
+
+	sampler *sampler
+}
+
+// Option configures a Logger in New.
+type Option func(*Logger)
+
+// WithSinks adds destinations. Without any, a Logger writes to Console(LogInfo).
+func WithSinks(sinks ...Sink) Option {
+	return func(l *Logger) {
+		l.sinks = append(l.sinks, sinks...)
+	}
+}
+
+// WithErrorHandler is called with every sink write error. It runs on the
+// logger's Goroutine, so it must not log through the same Logger.
+func WithErrorHandler(handler func(error)) Option {
+	return func(l *Logger) {
+		l.onError = handler
+	}
+}
+
+// New starts a Logger. Always know the exit strategy: call Close when done
+// with it so its Goroutine returns and its sinks are closed.
+func New(opts ...Option) *Logger {
+	l := &Logger{core: &core{
+		doneCh:    make(chan struct{}),
+		flushCh:   make(chan chan struct{}),
+		stoppedCh: make(chan struct{}),
+		onError: func(err error) {
+			fmt.Fprintln(os.Stderr, "logger:", err)
+		},
+		bufferSize: 50,
+	}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if len(l.sinks) == 0 {
+		l.sinks = []Sink{Console(LogInfo)}
+	}
+	if l.bufferSize < 1 {
+		l.bufferSize = 1
+	}
+	l.logCh = make(chan logEntry, l.bufferSize)
+	if l.overflow == SpillToDisk {
+		l.spill = &spillQueue{path: l.spillPath}
+		l.spillCh = make(chan struct{}, 1)
+	}
+	go l.core.run()
+	return l
+}
+
+/* With returns a child Logger adding fields to every entry it logs, on top
+ * of the ones l already adds:
+ *
+ *	reqLog := l.With(logger.String("request_id", id), logger.String("route", "/"))
+ */
+func (l *Logger) With(fields ...Field) *Logger {
+	if l == nil {
+		return nil
+	}
+	// full slice expression so siblings never append into each other's array
+	return &Logger{core: l.core, fields: append(l.fields[:len(l.fields):len(l.fields)], fields...)}
+}
+
+func (l *Logger) Info(msg string, fields ...Field)    { l.log(LogInfo, msg, fields) }
+func (l *Logger) Warning(msg string, fields ...Field) { l.log(LogWarning, msg, fields) }
+func (l *Logger) Error(msg string, fields ...Field)   { l.log(LogError, msg, fields) }
+
+func (l *Logger) log(severity Severity, msg string, fields []Field) {
+	if l == nil || l.core == nil {
+		return
+	}
+	if len(l.fields) > 0 {
+		fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// entries logged after shutdown are dropped, nobody would write them
+	if l.closed {
+		return
+	}
+	entry := logEntry{time.Now(), severity, msg, fields}
+	if l.sampler != nil {
+		ok, summary := l.sampler.allow(entry)
+		if summary != nil {
+			l.enqueue(*summary)
+		}
+		if !ok {
+			return
+		}
+	}
+	l.enqueue(entry)
+}
+
+// Flush returns once every entry logged before the call has been written,
+// or with ctx.Err() if ctx is done first.
+func (l *Logger) Flush(ctx context.Context) error {
+	if l == nil || l.core == nil {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case l.flushCh <- ack:
+	case <-l.stoppedCh:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/* Shutdown stops accepting entries, drains everything already queued,
+ * closes every sink that is a Closer and returns after the last one is
+ * written. If ctx is done first, Shutdown returns ctx.Err() and the
+ * Goroutine keeps draining in the background.
+ */
+func (l *Logger) Shutdown(ctx context.Context) error {
+	if l == nil || l.core == nil {
+		return nil
+	}
+	l.closeOnce.Do(func() { close(l.doneCh) })
+	select {
+	case <-l.stoppedCh:
+		return l.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close is Shutdown without a deadline.
+func (l *Logger) Close() error {
+	return l.Shutdown(context.Background())
+}
+
+func (c *core) run() {
+	defer close(c.stoppedCh)
+	// a nil channel blocks forever, so without sampling this case never fires
+	var sweepCh <-chan time.Time
+	if c.sampler != nil {
+		ticker := time.NewTicker(c.sampler.interval())
+		defer ticker.Stop()
+		sweepCh = ticker.C
+	}
+	for {
+		select {
+		case entry := <-c.logCh:
+			c.write(entry)
+		case <-c.spillCh:
+			c.drain()
+		case now := <-sweepCh:
+			c.drain()
+			for _, summary := range c.sampler.sweep(now, false) {
+				c.write(summary)
+			}
+		case ack := <-c.flushCh:
+			c.drain()
+			close(ack)
+		case <-c.doneCh:
+			// a bare "break" would only leave the select, return leaves the loop
+			c.stopAccepting()
+			c.drain()
+			if c.sampler != nil {
+				for _, summary := range c.sampler.sweep(time.Now(), true) {
+					c.write(summary)
+				}
+			}
+			c.closeErr = c.closeSinks()
+			if c.spill != nil {
+				if err := c.spill.remove(); err != nil && c.closeErr == nil {
+					c.closeErr = err
+				}
+			}
+			return
+		}
+	}
+}
+
+// stopAccepting sets closed, writing entries meanwhile so that senders
+// blocked on a full logCh, and holding the read lock, can finish.
+func (c *core) stopAccepting() {
+	locked := make(chan struct{})
+	go func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		close(locked)
+	}()
+	for {
+		select {
+		case entry := <-c.logCh:
+			c.write(entry)
+		case <-locked:
+			return
+		}
+	}
+}
+
+// drain writes whatever is buffered in logCh or spilled right now without
+// blocking. Channel entries always predate spilled ones, so they go first.
+func (c *core) drain() {
+	for {
+		select {
+		case entry := <-c.logCh:
+			c.write(entry)
+			continue
+		default:
+		}
+		if !c.unspill() {
+			return
+		}
+	}
+}
+
+// unspill writes every spilled entry and reports whether there were any.
+func (c *core) unspill() bool {
+	if c.spill == nil {
+		return false
+	}
+	if err := c.spill.takeErr(); err != nil {
+		c.onError(err)
+	}
+	found := false
+	for {
+		entry, ok, err := c.spill.pop()
+		if err != nil {
+			c.onError(err)
+		}
+		if !ok {
+			return found
+		}
+		found = true
+		c.write(entry)
+	}
+}
+
+func (c *core) write(entry logEntry) {
+	// encode lazily and once per format, an entry every sink filters out costs nothing
+	var lines [numFormats][]byte
+	for _, sink := range c.sinks {
+		if entry.severity < sink.MinSeverity {
+			continue
+		}
+		// sinks like SyslogWriter frame the entry themselves
+		if ew, ok := sink.Writer.(entryWriter); ok {
+			if err := ew.writeEntry(entry); err != nil {
+				c.onError(err)
+			}
+			continue
+		}
+		format := sink.Format
+		if format < 0 || format >= numFormats {
+			format = TextFormat
+		}
+		if lines[format] == nil {
+			lines[format] = encode(format, entry)
+		}
+		if _, err := sink.Writer.Write(lines[format]); err != nil {
+			c.onError(err)
+		}
+	}
+}
+
+type entryWriter interface {
+	writeEntry(entry logEntry) error
+}
+
+// closeSinks closes every WriterCloser sink and returns the first error.
+func (c *core) closeSinks() error {
+	var first error
+	for _, sink := range c.sinks {
+		c, ok := sink.Writer.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stalledWriter blocks every Write until release is closed.
+type stalledWriter struct {
+	release chan struct{}
+	n       int
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.n++
+	return len(p), nil
+}
+
+func TestShutdownDeadlineWithBlockedSenders(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	l := New(WithSinks(Sink{Writer: w}), WithBuffer(1, Block))
+	// one entry in the sink, one in the channel, the rest blocked sending
+	const entries = 4
+	for i := 0; i < entries; i++ {
+		go l.Info("stuck")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- l.Shutdown(ctx) }()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != context.DeadlineExceeded {
+				t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Shutdown ignored its deadline")
+		}
+	}
+
+	close(w.release)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.n != entries {
+		t.Errorf("wrote %d entries, want %d", w.n, entries)
+	}
+}
+
+func TestSpillFailureDrops(t *testing.T) {
+	w := &stalledWriter{release: make(chan struct{})}
+	// a file where the spill file's directory should be
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	spill := filepath.Join(notDir, "spill")
+	l := New(WithSinks(Sink{Writer: w}), WithBuffer(1, SpillToDisk), WithSpillPath(spill),
+		WithErrorHandler(func(error) {}))
+	defer func() {
+		close(w.release)
+		l.Close()
+	}()
+
+	logged := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			l.Info("burst")
+		}
+		close(logged)
+	}()
+	select {
+	case <-logged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("logging blocked on an unwritable spill file")
+	}
+	// at most one entry in the sink and one in the channel
+	if s := l.Stats(); s.Dropped < 3 || s.Spilled != 0 {
+		t.Errorf("Stats = %+v, want at least 3 dropped and none spilled", s)
+	}
+}
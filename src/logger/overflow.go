@@ -0,0 +1,273 @@
+package logger
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* OverflowPolicy decides what a call to Info/Warning/Error does when the
+ * entry channel is full, i.e. when sinks can't keep up with a burst.
+ *
+ * - Block waits for room, nothing is lost but callers stall
+ * - DropNewest throws the new entry away
+ * - DropOldest throws the oldest queued entry away to make room
+ * - SpillToDisk appends to a file-backed queue the Goroutine reads back
+ *   once it catches up, entries stay in order. If the file can't be
+ *   written, entries that don't fit are dropped instead, counted in
+ *   Stats like DropNewest
+ */
+type OverflowPolicy int
+
+const (
+	Block OverflowPolicy = iota
+	DropNewest
+	DropOldest
+	SpillToDisk
+)
+
+// Stats counts entries that didn't go through the channel.
+type Stats struct {
+	Dropped uint64
+	Spilled uint64
+}
+
+// WithBuffer sets the entry channel size (50 by default) and what happens
+// when it's full (Block by default).
+func WithBuffer(size int, policy OverflowPolicy) Option {
+	return func(l *Logger) {
+		l.bufferSize = size
+		l.overflow = policy
+	}
+}
+
+// WithSpillPath sets the file SpillToDisk queues to. It defaults to a
+// fresh file in os.TempDir and is removed on shutdown either way.
+func WithSpillPath(path string) Option {
+	return func(l *Logger) {
+		l.spillPath = path
+	}
+}
+
+// Stats returns how many entries were dropped or spilled so far.
+func (l *Logger) Stats() Stats {
+	if l == nil || l.core == nil {
+		return Stats{}
+	}
+	return Stats{
+		Dropped: atomic.LoadUint64(&l.dropped),
+		Spilled: atomic.LoadUint64(&l.spilled),
+	}
+}
+
+// enqueue hands entry to the Goroutine according to the overflow policy.
+func (c *core) enqueue(entry logEntry) {
+	switch c.overflow {
+	case DropNewest:
+		select {
+		case c.logCh <- entry:
+		default:
+			atomic.AddUint64(&c.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case c.logCh <- entry:
+				return
+			default:
+			}
+			// make room, unless the Goroutine just did
+			select {
+			case <-c.logCh:
+				atomic.AddUint64(&c.dropped, 1)
+			default:
+			}
+		}
+	case SpillToDisk:
+		spilled, dropped := c.spill.push(entry, c.logCh)
+		if dropped {
+			atomic.AddUint64(&c.dropped, 1)
+		}
+		if spilled {
+			atomic.AddUint64(&c.spilled, 1)
+			// wake the Goroutine up, one pending signal is enough
+			select {
+			case c.spillCh <- struct{}{}:
+			default:
+			}
+		}
+	default:
+		c.logCh <- entry
+	}
+}
+
+/* spillQueue is an append-only file of length-prefixed JSON records.
+ *
+ * Once anything is on disk every new entry goes to disk too, otherwise a
+ * newer entry could overtake the spilled ones through the channel. The
+ * file is truncated whenever the reader catches up.
+ *
+ * Fields survive the round trip as their JSON form: numbers come back as
+ * float64, durations and errors as strings.
+ */
+type spillQueue struct {
+	path string
+
+	mu       sync.Mutex
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	pending  int
+	err      error // first error, reported by the Goroutine
+}
+
+type spilledEntry struct {
+	Time     time.Time
+	Severity Severity
+	Message  string
+	Fields   []spilledField
+}
+
+type spilledField struct {
+	Key   string
+	Value interface{}
+}
+
+// push sends entry down ch if nothing is spilled and there's room,
+// otherwise appends it to the file. It reports whether entry was spilled,
+// and dropped if it couldn't be: sending it down ch while older entries
+// wait on disk would break the order, and waiting for room would make a
+// broken disk stall callers.
+func (q *spillQueue) push(entry logEntry, ch chan<- logEntry) (spilled, dropped bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == 0 {
+		select {
+		case ch <- entry:
+			return false, false
+		default:
+		}
+	}
+	if err := q.append(entry); err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+		return false, true
+	}
+	q.pending++
+	return true, false
+}
+
+func (q *spillQueue) append(entry logEntry) error {
+	if q.file == nil {
+		if err := q.open(); err != nil {
+			return err
+		}
+	}
+	rec := spilledEntry{entry.time, entry.severity, entry.message, nil}
+	for _, f := range entry.fields {
+		rec.Fields = append(rec.Fields, spilledField{f.Key, plainValue(f.Value)})
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := q.file.WriteAt(buf, q.writeOff); err != nil {
+		return err
+	}
+	q.writeOff += int64(len(buf))
+	return nil
+}
+
+func (q *spillQueue) open() error {
+	var err error
+	if q.path == "" {
+		q.file, err = os.CreateTemp("", "logger-spill-*")
+	} else {
+		if err = os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+			return err
+		}
+		q.file, err = os.OpenFile(q.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	}
+	return err
+}
+
+// pop returns the oldest spilled entry, ok is false when the queue is
+// empty. A record that doesn't decode is skipped and reported in err
+// alongside the next good entry, so one bad record doesn't lose the rest.
+func (q *spillQueue) pop() (entry logEntry, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending > 0 {
+		var size [4]byte
+		if _, rerr := q.file.ReadAt(size[:], q.readOff); rerr != nil {
+			return logEntry{}, false, q.reset(rerr)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, rerr := q.file.ReadAt(data, q.readOff+4); rerr != nil {
+			return logEntry{}, false, q.reset(rerr)
+		}
+		q.readOff += int64(4 + len(data))
+		q.pending--
+		if q.pending == 0 {
+			if rerr := q.reset(nil); rerr != nil {
+				return logEntry{}, false, rerr
+			}
+		}
+
+		var rec spilledEntry
+		if derr := json.Unmarshal(data, &rec); derr != nil {
+			if err == nil {
+				err = derr
+			}
+			continue
+		}
+		entry = logEntry{time: rec.Time, severity: rec.Severity, message: rec.Message}
+		for _, f := range rec.Fields {
+			entry.fields = append(entry.fields, Field{f.Key, f.Value})
+		}
+		return entry, true, err
+	}
+	return logEntry{}, false, err
+}
+
+// reset empties the file. A read error means the rest of the file is
+// unusable, so it's dropped too and cause is passed back.
+func (q *spillQueue) reset(cause error) error {
+	if cause == io.EOF {
+		cause = io.ErrUnexpectedEOF
+	}
+	q.pending, q.readOff, q.writeOff = 0, 0, 0
+	if err := q.file.Truncate(0); err != nil && cause == nil {
+		cause = err
+	}
+	return cause
+}
+
+// takeErr returns and clears the first push error.
+func (q *spillQueue) takeErr() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// remove deletes the file once the Goroutine is done with it.
+func (q *spillQueue) remove() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	q.file.Close()
+	return os.Remove(q.file.Name())
+}
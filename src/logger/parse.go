@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a log line read back, whichever Format wrote it.
+type Record struct {
+	Time     time.Time
+	Severity Severity
+	Message  string
+	Fields   map[string]string
+}
+
+// ErrUnparsable is returned by ParseLine for lines no Format could have written.
+var ErrUnparsable = errors.New("logger: unparsable line")
+
+// ParseSeverity is the inverse of Severity.String, case insensitive.
+func ParseSeverity(s string) (Severity, error) {
+	for _, sev := range []Severity{LogInfo, LogWarning, LogError} {
+		if strings.EqualFold(s, sev.String()) {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("logger: unknown severity %q", s)
+}
+
+/* ParseLine detects the Format of line and parses it.
+ *
+ * Text lines are ambiguous since the message is free form: trailing
+ * key=value words are taken as fields, so a message that itself ends in
+ * "a=b" comes back with a field it never had. Text timestamps carry no
+ * zone and are read as local time.
+ */
+func ParseLine(line string) (Record, error) {
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "{"):
+		return parseJSON(line)
+	case strings.HasPrefix(line, "time="):
+		return parseLogfmt(line)
+	}
+	return parseText(line)
+}
+
+func parseText(line string) (Record, error) {
+	// 2006-01-02T15:04:05 - [SEVERITY]message k=v
+	sep := strings.Index(line, " - [")
+	if sep < 0 {
+		return Record{}, ErrUnparsable
+	}
+	t, err := time.ParseInLocation(textTimeLayout, line[:sep], time.Local)
+	if err != nil {
+		return Record{}, ErrUnparsable
+	}
+	rest := line[sep+4:]
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return Record{}, ErrUnparsable
+	}
+	sev, err := ParseSeverity(rest[:end])
+	if err != nil {
+		return Record{}, ErrUnparsable
+	}
+	rec := Record{Time: t, Severity: sev, Message: rest[end+1:], Fields: map[string]string{}}
+
+	// peel key=value pairs off the end of the message
+	pairs := splitLogfmt(rec.Message)
+	cut := len(rec.Message)
+	for i := len(pairs) - 1; i >= 0; i-- {
+		p := pairs[i]
+		if p.key == "" || p.start == 0 {
+			break
+		}
+		rec.Fields[p.key] = p.value
+		cut = p.start - 1
+	}
+	rec.Message = rec.Message[:cut]
+	return rec, nil
+}
+
+func parseLogfmt(line string) (Record, error) {
+	rec := Record{Fields: map[string]string{}}
+	for _, p := range splitLogfmt(line) {
+		if p.key == "" {
+			return Record{}, ErrUnparsable
+		}
+		rec.Fields[p.key] = p.value
+	}
+	if err := rec.takeHeader(); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+func parseJSON(line string) (Record, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return Record{}, ErrUnparsable
+	}
+	rec := Record{Fields: map[string]string{}}
+	for k, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			rec.Fields[k] = s
+		} else {
+			rec.Fields[k] = string(bytes.TrimSpace(v))
+		}
+	}
+	if err := rec.takeHeader(); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// takeHeader moves time, severity and message out of Fields.
+func (rec *Record) takeHeader() error {
+	t, err := time.Parse(structuredTimeLayout, rec.Fields["time"])
+	if err != nil {
+		return ErrUnparsable
+	}
+	sev, err := ParseSeverity(rec.Fields["severity"])
+	if err != nil {
+		return ErrUnparsable
+	}
+	rec.Time, rec.Severity, rec.Message = t, sev, rec.Fields["message"]
+	delete(rec.Fields, "time")
+	delete(rec.Fields, "severity")
+	delete(rec.Fields, "message")
+	return nil
+}
+
+// logfmtPair is one word of a logfmt line, key is empty if it had no '='.
+type logfmtPair struct {
+	key, value string
+	start      int // offset of the word in the line
+}
+
+func splitLogfmt(line string) []logfmtPair {
+	var pairs []logfmtPair
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		if i == len(line) || line[i] != '=' || i == start {
+			// not a pair, skip the word
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			pairs = append(pairs, logfmtPair{start: start})
+			continue
+		}
+		key := line[start:i]
+		i++
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := quotedEnd(line, i)
+			unquoted, err := strconv.Unquote(line[i:end])
+			if err != nil {
+				unquoted = line[i:end]
+			}
+			value, i = unquoted, end
+		} else {
+			vstart := i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[vstart:i]
+		}
+		pairs = append(pairs, logfmtPair{key, value, start})
+	}
+	return pairs
+}
+
+// quotedEnd returns the offset just past the string literal starting at i.
+func quotedEnd(line string, i int) int {
+	for j := i + 1; j < len(line); j++ {
+		switch line[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,251 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* RotateConfig says when a RotatingFile rolls over and what it keeps.
+ *
+ *	logger.RotateConfig{MaxSize: 100 * units.MB, Daily: true, MaxBackups: 7, Compress: true}
+ */
+type RotateConfig struct {
+	MaxSize    int64 // bytes before rolling over, 0 means no limit
+	Daily      bool  // also roll over at local midnight
+	MaxBackups int   // rotated files to keep, 0 keeps them all
+	Compress   bool  // gzip rotated files
+}
+
+/* RotatingFile is a WriterCloser appending to path. Rotated generations are
+ * path.1 (newest) to path.N, with a .gz suffix when compressed.
+ */
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+
+	mu     sync.Mutex
+	file   *os.File // nil after Close, or if reopening after a rotation failed
+	closed bool
+	size   int64
+	day    time.Time // midnight of the day the current file was started
+}
+
+// NewRotatingFile opens (or creates) path for appending.
+func NewRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, cfg: cfg}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Rotating is File with rotation.
+func Rotating(path string, min Severity, cfg RotateConfig) (Sink, error) {
+	rf, err := NewRotatingFile(path, cfg)
+	if err != nil {
+		return Sink{}, err
+	}
+	return Sink{Writer: rf, MinSeverity: min}, nil
+}
+
+// Write appends data. If rolling over fails, data still goes to path and
+// the rotation error is returned alongside n == len(data); the next Write
+// tries to roll over again.
+func (rf *RotatingFile) Write(data []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if err := rf.ensureOpen(); err != nil {
+		return 0, err
+	}
+	var rotateErr error
+	if rf.shouldRotate(len(data), time.Now()) {
+		rotateErr = rf.rotate()
+		if rf.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := rf.file.Write(data)
+	rf.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Rotate rolls over right away.
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if err := rf.ensureOpen(); err != nil {
+		return err
+	}
+	return rf.rotate()
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return nil
+	}
+	rf.closed = true
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// ensureOpen reopens path if a rotation left no file open.
+func (rf *RotatingFile) ensureOpen() error {
+	if rf.closed {
+		return os.ErrClosed
+	}
+	if rf.file == nil {
+		return rf.open()
+	}
+	return nil
+}
+
+func (rf *RotatingFile) shouldRotate(n int, now time.Time) bool {
+	// an empty file never rotates, a write bigger than MaxSize gets a file to itself
+	if rf.size == 0 {
+		return false
+	}
+	if rf.cfg.MaxSize > 0 && rf.size+int64(n) > rf.cfg.MaxSize {
+		return true
+	}
+	return rf.cfg.Daily && !midnight(now).Equal(rf.day)
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	// a file left over from yesterday belongs to yesterday
+	rf.day = midnight(info.ModTime())
+	if rf.size == 0 {
+		rf.day = midnight(time.Now())
+	}
+	return nil
+}
+
+// rotate rolls over. Whatever goes wrong on the way, path is reopened
+// afterwards: a failed rotation should cost a bigger file, not every
+// entry from then on.
+func (rf *RotatingFile) rotate() error {
+	err := rf.file.Close()
+	rf.file = nil
+	if err == nil {
+		err = rf.shift()
+	}
+	if oerr := rf.open(); oerr != nil {
+		return errors.Join(err, oerr)
+	}
+	return err
+}
+
+// shift moves path to path.1, and every older generation up by one.
+func (rf *RotatingFile) shift() error {
+	// find the oldest generation, then shift everything up by one
+	last := 0
+	for rf.backup(last+1) != "" {
+		last++
+	}
+	for i := last; i >= 1; i-- {
+		name := rf.backup(i)
+		if rf.cfg.MaxBackups > 0 && i >= rf.cfg.MaxBackups {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Rename(name, rf.generation(i+1, isGzip(name))); err != nil {
+			return err
+		}
+	}
+
+	first := rf.generation(1, false)
+	if err := os.Rename(rf.path, first); err != nil {
+		return err
+	}
+	if rf.cfg.Compress {
+		if err := compressFile(first); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generation is the name of the i-th rotated file.
+func (rf *RotatingFile) generation(i int, gz bool) string {
+	name := fmt.Sprintf("%s.%d", rf.path, i)
+	if gz {
+		name += ".gz"
+	}
+	return name
+}
+
+// backup returns the existing i-th rotated file, compressed or not, or "".
+func (rf *RotatingFile) backup(i int) string {
+	for _, gz := range []bool{false, true} {
+		name := rf.generation(i, gz)
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func isGzip(name string) bool {
+	return strings.HasSuffix(name, ".gz")
+}
+
+// compressFile replaces name with name.gz.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return os.Remove(name)
+}
+
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/* SamplingConfig thins out repeated entries. Entries are repeats when they
+ * share a severity and message (fields don't count). Within each Interval
+ * the First repeats go through, after that only every Thereafter-th one
+ * does (none if Thereafter is 0).
+ *
+ * When a window that suppressed anything closes, a summary entry with the
+ * same severity is written in their place:
+ *
+ *	2021-06-01T10:00:01 - [ERROR]suppressed 1,204 similar messages sampled="db timeout"
+ */
+type SamplingConfig struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// WithSampling samples entries of the given severities, or of all of them
+// if none are given. Later calls override earlier ones per severity.
+func WithSampling(cfg SamplingConfig, severities ...Severity) Option {
+	return func(l *Logger) {
+		if cfg.Interval <= 0 {
+			return
+		}
+		if l.sampler == nil {
+			l.sampler = &sampler{configs: map[Severity]SamplingConfig{}, windows: map[sampleKey]*sampleWindow{}}
+		}
+		if len(severities) == 0 {
+			severities = []Severity{LogInfo, LogWarning, LogError}
+		}
+		for _, s := range severities {
+			l.sampler.configs[s] = cfg
+		}
+	}
+}
+
+type sampleKey struct {
+	severity Severity
+	message  string
+}
+
+type sampleWindow struct {
+	start      time.Time
+	seen       int
+	suppressed uint64
+}
+
+type sampler struct {
+	configs map[Severity]SamplingConfig // read only once New returns
+
+	mu      sync.Mutex
+	windows map[sampleKey]*sampleWindow
+}
+
+// interval is how often the Goroutine should sweep closed windows.
+func (s *sampler) interval() time.Duration {
+	var min time.Duration
+	for _, cfg := range s.configs {
+		if min == 0 || cfg.Interval < min {
+			min = cfg.Interval
+		}
+	}
+	return min
+}
+
+/* allow reports whether entry should be logged. If entry is the first of a
+ * new window and the previous one suppressed anything, its summary is
+ * returned too, to be logged before entry.
+ */
+func (s *sampler) allow(entry logEntry) (ok bool, summary *logEntry) {
+	cfg, sampled := s.configs[entry.severity]
+	if !sampled {
+		return true, nil
+	}
+	key := sampleKey{entry.severity, entry.message}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.windows[key]
+	if w != nil && entry.time.Sub(w.start) >= cfg.Interval {
+		summary = w.summary(key, entry.time)
+		w = nil
+	}
+	if w == nil {
+		w = &sampleWindow{start: entry.time}
+		s.windows[key] = w
+	}
+	w.seen++
+	if w.seen <= cfg.First || (cfg.Thereafter > 0 && (w.seen-cfg.First)%cfg.Thereafter == 0) {
+		return true, summary
+	}
+	w.suppressed++
+	return false, summary
+}
+
+// sweep forgets windows closed by now (all of them if force is set) and
+// returns the summaries of those that suppressed anything.
+func (s *sampler) sweep(now time.Time, force bool) []logEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summaries []logEntry
+	for key, w := range s.windows {
+		if !force && now.Sub(w.start) < s.configs[key.severity].Interval {
+			continue
+		}
+		if summary := w.summary(key, now); summary != nil {
+			summaries = append(summaries, *summary)
+		}
+		delete(s.windows, key)
+	}
+	return summaries
+}
+
+func (w *sampleWindow) summary(key sampleKey, now time.Time) *logEntry {
+	if w.suppressed == 0 {
+		return nil
+	}
+	return &logEntry{
+		time:     now,
+		severity: key.severity,
+		message:  fmt.Sprintf("suppressed %s similar messages", withCommas(w.suppressed)),
+		fields:   []Field{String("sampled", key.message)},
+	}
+}
+
+// withCommas formats 1204 as "1,204".
+func withCommas(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
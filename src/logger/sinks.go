@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+/* Sink is one destination for entries. Anything with a Write method will
+ * do (the Writer interface from interfaces.go, *os.File, *bytes.Buffer,
+ * net.Conn, ...), and a Writer that is also a Closer (a WriterCloser) is
+ * closed when the Logger shuts down.
+ *
+ * Entries below MinSeverity are skipped for this Sink only, so the same
+ * call can reach the console at LogInfo and a file at LogError. Format
+ * defaults to TextFormat.
+ */
+type Sink struct {
+	Writer      io.Writer
+	MinSeverity Severity
+	Format      Format
+}
+
+// consoleWriter hides os.Stdout's Close so shutting a Logger down doesn't
+// close the process' stdout.
+type consoleWriter struct {
+	io.Writer
+}
+
+// Console writes to stdout.
+func Console(min Severity) Sink {
+	return Sink{Writer: consoleWriter{os.Stdout}, MinSeverity: min}
+}
+
+// File appends to the file at path, creating it if needed.
+func File(path string, min Severity) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return Sink{}, err
+	}
+	return Sink{Writer: f, MinSeverity: min}, nil
+}
+
+// Dial writes to a network connection, e.g. Dial("tcp", "localhost:5000", LogWarning).
+func Dial(network, addr string, min Severity) (Sink, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return Sink{}, err
+	}
+	return Sink{Writer: conn, MinSeverity: min}, nil
+}
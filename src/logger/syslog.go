@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is the syslog facility entries are filed under.
+type Facility int
+
+const (
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityLocal0 Facility = 16
+	FacilityLocal1 Facility = 17
+	FacilityLocal2 Facility = 18
+	FacilityLocal3 Facility = 19
+	FacilityLocal4 Facility = 20
+	FacilityLocal5 Facility = 21
+	FacilityLocal6 Facility = 22
+	FacilityLocal7 Facility = 23
+)
+
+/* SyslogConfig says where a SyslogWriter sends its frames.
+ *
+ * Network is "udp", "tcp", "unix" (stream) or "unixgram". Stream transports
+ * use octet-counted framing (RFC 6587), datagrams carry one frame each.
+ * Facility defaults to FacilityUser, AppName to the program name and
+ * Hostname to os.Hostname().
+ */
+type SyslogConfig struct {
+	Network  string
+	Addr     string
+	Facility Facility
+	AppName  string
+	Hostname string
+}
+
+/* SyslogWriter ships entries as RFC 5424 frames:
+ *
+ *	<14>1 2021-06-01T10:00:00.000000Z host app 42 - [fields@32473 user="tim"] message
+ *
+ * Before writing to a stream connection it checks the receiver hasn't
+ * closed it, e.g. by restarting, and redials if so: a write to a closed
+ * connection still succeeds locally and the frame is lost. If a write
+ * fails anyway it redials and tries once more before giving up on that
+ * entry.
+ *
+ * Frames can still be lost without an error when the receiver vanishes
+ * without closing the connection (a crashed host, a network partition),
+ * or over UDP whenever nothing is listening. Outside Unix the closed
+ * connection check isn't available either, so the first frame after a
+ * receiver restart is lost there.
+ */
+type SyslogWriter struct {
+	cfg    SyslogConfig
+	procID string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// private enterprise number reserved for documentation, RFC 5612
+const syslogFieldsID = "fields@32473"
+
+// DialSyslog connects to the receiver described by cfg.
+func DialSyslog(cfg SyslogConfig) (*SyslogWriter, error) {
+	if cfg.Facility == 0 {
+		cfg.Facility = FacilityUser
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = filepath.Base(os.Args[0])
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	w := &SyslogWriter{cfg: cfg, procID: fmt.Sprint(os.Getpid())}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Syslog is a Sink shipping to a syslog receiver, Format is ignored.
+func Syslog(cfg SyslogConfig, min Severity) (Sink, error) {
+	w, err := DialSyslog(cfg)
+	if err != nil {
+		return Sink{}, err
+	}
+	return Sink{Writer: w, MinSeverity: min}, nil
+}
+
+// Write sends data as a single LogInfo message.
+func (w *SyslogWriter) Write(data []byte) (int, error) {
+	msg := strings.TrimRight(string(data), "\n")
+	if err := w.writeEntry(logEntry{time: time.Now(), severity: LogInfo, message: msg}); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) writeEntry(entry logEntry) error {
+	frame := w.frame(entry)
+	if w.stream() {
+		frame = append([]byte(fmt.Sprintf("%d ", len(frame))), frame...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil && w.stream() && peerClosed(w.conn) {
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.conn != nil {
+		if _, err := w.conn.Write(frame); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	// first attempt failed or the last redial did, try a fresh connection
+	if err := w.dial(); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(frame); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *SyslogWriter) dial() error {
+	conn, err := net.Dial(w.cfg.Network, w.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *SyslogWriter) stream() bool {
+	return w.cfg.Network == "tcp" || w.cfg.Network == "tcp4" || w.cfg.Network == "tcp6" || w.cfg.Network == "unix"
+}
+
+func (w *SyslogWriter) frame(entry logEntry) []byte {
+	var b bytes.Buffer
+	pri := int(w.cfg.Facility)*8 + syslogSeverity(entry.severity)
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		pri,
+		entry.time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(w.cfg.Hostname, 255),
+		syslogHeader(w.cfg.AppName, 48),
+		syslogHeader(w.procID, 128),
+	)
+	if len(entry.fields) == 0 {
+		b.WriteByte('-')
+	} else {
+		b.WriteString("[" + syslogFieldsID)
+		for _, f := range entry.fields {
+			fmt.Fprintf(&b, ` %s="%s"`, syslogParamName(f.Key), syslogParamValue(f.Value))
+		}
+		b.WriteByte(']')
+	}
+	if entry.message != "" {
+		b.WriteByte(' ')
+		b.WriteString(entry.message)
+	}
+	return b.Bytes()
+}
+
+// syslogSeverity maps onto the RFC 5424 numeric severities.
+func syslogSeverity(s Severity) int {
+	switch s {
+	case LogError:
+		return 3
+	case LogWarning:
+		return 4
+	}
+	return 6 // informational
+}
+
+// syslogHeader makes s a valid header field: printable ASCII, no spaces, "-" if empty.
+func syslogHeader(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func syslogParamName(key string) string {
+	key = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	return syslogHeader(key, 32)
+}
+
+// syslogParamValue escapes '"', '\' and ']' as the RFC requires.
+func syslogParamValue(v interface{}) string {
+	s := fmt.Sprint(plainValue(v))
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
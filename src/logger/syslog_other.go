@@ -0,0 +1,9 @@
+//go:build !unix
+
+package logger
+
+import "net"
+
+// peerClosed can't peek at the socket here, a dead connection is only
+// noticed when a write to it fails.
+func peerClosed(conn net.Conn) bool { return false }
@@ -0,0 +1,218 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tcpReceiver accepts connections and sends every octet-counted frame it
+// reads down frames.
+type tcpReceiver struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startTCPReceiver(t *testing.T, addr string, frames chan<- string) *tcpReceiver {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &tcpReceiver{ln: ln}
+	t.Cleanup(r.close)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			r.conns = append(r.conns, conn)
+			r.mu.Unlock()
+			go readFrames(t, conn, frames)
+		}
+	}()
+	return r
+}
+
+func readFrames(t *testing.T, conn net.Conn, frames chan<- string) {
+	br := bufio.NewReader(conn)
+	for {
+		size, err := br.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Errorf("bad octet count %q", size)
+			return
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			t.Errorf("short frame: %v", err)
+			return
+		}
+		frames <- string(frame)
+	}
+}
+
+// close stops the receiver the way a restarting daemon does, listener and
+// connections both.
+func (r *tcpReceiver) close() {
+	r.ln.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		c.Close()
+	}
+	r.conns = nil
+}
+
+// packetReceiver sends every datagram read from pc down frames.
+func packetReceiver(pc net.PacketConn, frames chan<- string) {
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			frames <- string(buf[:n])
+		}
+	}()
+}
+
+func nextFrame(t *testing.T, frames <-chan string) string {
+	t.Helper()
+	select {
+	case f := <-frames:
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame received")
+		return ""
+	}
+}
+
+// logAll writes one entry per severity through a Logger with a syslog sink.
+func logAll(t *testing.T, network, addr string) {
+	t.Helper()
+	sink, err := Syslog(SyslogConfig{
+		Network:  network,
+		Addr:     addr,
+		Facility: FacilityLocal0,
+		AppName:  "app",
+		Hostname: "host",
+	}, LogInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(WithSinks(sink))
+	l.Info("starting")
+	l.Warning("disk at 90%", Int("pct", 90))
+	l.Error("payment failed", String("order", `a"b]`))
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyslogFraming(t *testing.T) {
+	tests := []struct {
+		network string
+		listen  func(t *testing.T, frames chan<- string) (addr string)
+	}{
+		{"tcp", func(t *testing.T, frames chan<- string) string {
+			return startTCPReceiver(t, "127.0.0.1:0", frames).ln.Addr().String()
+		}},
+		{"udp", func(t *testing.T, frames chan<- string) string {
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			packetReceiver(pc, frames)
+			return pc.LocalAddr().String()
+		}},
+		{"unixgram", func(t *testing.T, frames chan<- string) string {
+			if runtime.GOOS == "windows" {
+				t.Skip("no unixgram on windows")
+			}
+			// t.TempDir can exceed the socket path limit
+			dir, err := os.MkdirTemp("", "syslog")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			addr := filepath.Join(dir, "log.sock")
+			pc, err := net.ListenPacket("unixgram", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			packetReceiver(pc, frames)
+			return addr
+		}},
+	}
+
+	pid := os.Getpid()
+	want := []struct{ prefix, suffix string }{
+		// local0 is 16, so PRI is 128 + the RFC 5424 severity
+		{"<134>1 ", fmt.Sprintf(" host app %d - - starting", pid)},
+		{"<132>1 ", fmt.Sprintf(` host app %d - [fields@32473 pct="90"] disk at 90%%`, pid)},
+		{"<131>1 ", fmt.Sprintf(` host app %d - [fields@32473 order="a\"b\]"] payment failed`, pid)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			frames := make(chan string, 10)
+			addr := tt.listen(t, frames)
+			logAll(t, tt.network, addr)
+			for _, w := range want {
+				f := nextFrame(t, frames)
+				if !strings.HasPrefix(f, w.prefix) || !strings.HasSuffix(f, w.suffix) {
+					t.Errorf("frame %q, want %q...%q", f, w.prefix, w.suffix)
+				}
+			}
+		})
+	}
+}
+
+func TestSyslogReceiverRestart(t *testing.T) {
+	frames := make(chan string, 10)
+	r := startTCPReceiver(t, "127.0.0.1:0", frames)
+	addr := r.ln.Addr().String()
+
+	w, err := DialSyslog(SyslogConfig{Network: "tcp", Addr: addr, AppName: "app", Hostname: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	if f := nextFrame(t, frames); !strings.HasSuffix(f, " before") {
+		t.Fatalf("got %q", f)
+	}
+
+	r.close()
+	startTCPReceiver(t, addr, frames)
+
+	// every frame written after the restart must arrive, the first one too
+	for _, msg := range []string{"after 1", "after 2"} {
+		if _, err := w.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if f := nextFrame(t, frames); !strings.HasSuffix(f, " "+msg) {
+			t.Fatalf("got %q, want %q", f, msg)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package logger
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerClosed reports whether the receiver closed or reset a stream
+// connection. Receivers never send anything, so a non-blocking read finds
+// nothing on a live connection, and EOF or an error on a dead one.
+func peerClosed(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	closed := false
+	rc.Read(func(fd uintptr) bool {
+		var b [1]byte
+		n, err := syscall.Read(int(fd), b[:])
+		closed = (n == 0 && err == nil) || (err != nil && err != syscall.EAGAIN && err != syscall.EWOULDBLOCK)
+		// done either way, never wait for data
+		return true
+	})
+	return closed
+}
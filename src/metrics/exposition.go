@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ContentType is the Prometheus text exposition format, version 0.0.4.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP makes a Registry the /metrics handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+/* WriteTo renders every metric, families sorted by name and series by
+ * labels, e.g.
+ *
+ *	# HELP http_requests_total Requests served.
+ *	# TYPE http_requests_total counter
+ *	http_requests_total{route="/"} 42
+ */
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type series struct {
+		key string
+		m   metric
+	}
+	families := make([]*family, len(names))
+	snapshot := make([][]series, len(names))
+	for i, name := range names {
+		f := r.families[name]
+		families[i] = f
+		for key, m := range f.series {
+			snapshot[i] = append(snapshot[i], series{key, m})
+		}
+		sort.Slice(snapshot[i], func(a, b int) bool { return snapshot[i][a].key < snapshot[i][b].key })
+	}
+	r.mu.RUnlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for i, f := range families {
+		if f.help != "" {
+			fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		}
+		fmt.Fprintf(cw, "# TYPE %s %v\n", f.name, f.kind)
+		for _, s := range snapshot[i] {
+			switch m := s.m.(type) {
+			case *Counter:
+				writeSample(cw, f.name, s.key, "", float64(m.Load()))
+			case *Gauge:
+				writeSample(cw, f.name, s.key, "", m.Load())
+			case *Histogram:
+				writeHistogram(cw, f.name, s.key, m)
+			}
+		}
+	}
+	if err := cw.w.(*bufio.Writer).Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+func writeHistogram(w io.Writer, name, key string, h *Histogram) {
+	var cumulative uint64
+	for i, upper := range h.upper {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		writeSample(w, name+"_bucket", key, `le="`+formatFloat(upper)+`"`, float64(cumulative))
+	}
+	// read count last, so +Inf is never below the finite buckets
+	cumulative += atomic.LoadUint64(&h.counts[len(h.upper)])
+	writeSample(w, name+"_bucket", key, `le="+Inf"`, float64(cumulative))
+	writeSample(w, name+"_sum", key, "", h.sum.Load())
+	writeSample(w, name+"_count", key, "", float64(cumulative))
+}
+
+func writeSample(w io.Writer, name, key, extra string, v float64) {
+	labels := key
+	if extra != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += extra
+	}
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// countingWriter keeps WriteTo's byte count and first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(data)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
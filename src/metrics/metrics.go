@@ -0,0 +1,224 @@
+/* Package metrics registers counters, gauges and histograms by name and
+ * labels and serves them in the Prometheus text exposition format.
+ *
+ * For the server in controlFlow/panic.go, /metrics is one more line:
+ *
+ *	requests := metrics.Default.Counter("http_requests_total", "Requests served.", metrics.Labels{"route": "/"})
+ *	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+ *		requests.Increment()
+ *		w.Write([]byte("Oh hi"))
+ *	})
+ *	http.Handle("/metrics", metrics.Default)
+ */
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tjapit/go-learn/src/counters"
+)
+
+// Default is a Registry for programs that only need one.
+var Default = NewRegistry()
+
+// Labels tell apart series of the same metric, e.g. {"route": "/", "code": "200"}.
+type Labels map[string]string
+
+type kind int
+
+const (
+	counterKind kind = iota
+	gaugeKind
+	histogramKind
+)
+
+func (k kind) String() string {
+	return [...]string{"counter", "gauge", "histogram"}[k]
+}
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// family is every series sharing a name.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	buckets []float64         // histograms only
+	series  map[string]metric // keyed by the rendered label set
+}
+
+type metric interface{}
+
+// Registry holds metric families. Asking for the same name and labels
+// twice returns the same metric, so handlers can look them up freely.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Counter is a value that only goes up. It's an Incrementer like the
+// ones in the counters package.
+type Counter struct {
+	c counters.AtomicCounter
+}
+
+var _ counters.Incrementer = (*Counter)(nil)
+
+func (c *Counter) Increment() int { return c.c.Increment() }
+
+// Add panics on a negative delta, counters never go down.
+func (c *Counter) Add(delta int) int {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	return c.c.Add(delta)
+}
+
+func (c *Counter) Load() int { return c.c.Load() }
+
+// Gauge is a value that goes up and down, like a queue length.
+type Gauge struct {
+	bits uint64 // float64 bits, for sync/atomic
+}
+
+func (g *Gauge) Set(v float64) { atomic.StoreUint64(&g.bits, math.Float64bits(v)) }
+func (g *Gauge) Load() float64 { return math.Float64frombits(atomic.LoadUint64(&g.bits)) }
+func (g *Gauge) Inc()          { g.Add(1) }
+func (g *Gauge) Dec()          { g.Add(-1) }
+
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, next) {
+			return
+		}
+	}
+}
+
+// DefBuckets suit request durations in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets, e.g. request durations.
+type Histogram struct {
+	upper  []float64 // sorted bucket upper bounds, +Inf implied
+	counts []uint64  // per bucket, not cumulative
+	sum    Gauge
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	h.sum.Add(v)
+}
+
+// Counter returns the counter with this name and labels, creating it on
+// first use. Like the other getters it panics on invalid names or when
+// name is already registered as another kind, both programming errors.
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	return r.get(name, help, counterKind, nil, labels, func(*family) metric { return &Counter{} }).(*Counter)
+}
+
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return r.get(name, help, gaugeKind, nil, labels, func(*family) metric { return &Gauge{} }).(*Gauge)
+}
+
+// Histogram uses buckets, or DefBuckets if nil. Buckets are fixed by the
+// first call for a name. The +Inf bucket is always there, so a +Inf bound
+// is dropped, as are repeated bounds; a NaN bound panics.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels Labels) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	bounds := buckets[:0]
+	for _, b := range buckets {
+		switch {
+		case math.IsNaN(b):
+			panic(fmt.Sprintf("metrics: NaN bucket bound for %s", name))
+		case math.IsInf(b, 1), len(bounds) > 0 && b == bounds[len(bounds)-1]:
+			continue
+		}
+		bounds = append(bounds, b)
+	}
+	buckets = bounds
+	return r.get(name, help, histogramKind, buckets, labels, func(f *family) metric {
+		return &Histogram{upper: f.buckets, counts: make([]uint64, len(f.buckets)+1)}
+	}).(*Histogram)
+}
+
+func (r *Registry) get(name, help string, k kind, buckets []float64, labels Labels, create func(*family) metric) metric {
+	key := labelKey(labels)
+
+	// fast path, the metric usually exists already
+	r.mu.RLock()
+	f := r.families[name]
+	if f != nil && f.kind == k {
+		if m, ok := f.series[key]; ok {
+			r.mu.RUnlock()
+			return m
+		}
+	}
+	r.mu.RUnlock()
+
+	if !metricNameRe.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for l := range labels {
+		if !labelNameRe.MatchString(l) || strings.HasPrefix(l, "__") || (k == histogramKind && l == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f = r.families[name]
+	if f == nil {
+		f = &family{name: name, help: help, kind: k, buckets: buckets, series: map[string]metric{}}
+		r.families[name] = f
+	}
+	if f.kind != k {
+		panic(fmt.Sprintf("metrics: %s is a %v, not a %v", name, f.kind, k))
+	}
+	m, ok := f.series[key]
+	if !ok {
+		m = create(f)
+		f.series[key] = m
+	}
+	return m
+}
+
+// labelKey renders labels sorted by name, as they appear in the exposition.
+func labelKey(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for l := range labels {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, l := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, l, escapeLabelValue(labels[l]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
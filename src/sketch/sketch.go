@@ -0,0 +1,63 @@
+/* Package sketch counts huge streams in fixed memory, trading exactness
+ * for a small, known error:
+ *
+ * - HyperLogLog: how many distinct items, e.g. unique visitors
+ * - CountMinSketch: how often one item was seen, never less than the truth
+ * - TopK: the heaviest hitters, e.g. the hottest routes
+ *
+ * All three are safe for concurrent use, merge with others of the same
+ * shape, so each Goroutine or server can keep its own and combine them
+ * later, and implement encoding.BinaryMarshaler to be saved or shipped.
+ *
+ * For the server in controlFlow/panic.go:
+ *
+ *	visitors := sketch.NewHyperLogLog(14)
+ *	routes := sketch.NewTopK(10, 0.001, 0.01)
+ *	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+ *		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+ *		visitors.Add(host)
+ *		routes.Add(r.URL.Path, 1)
+ *		w.Write([]byte("Oh hi"))
+ *	})
+ */
+package sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+var (
+	// ErrIncompatible is returned when merging sketches of different shapes.
+	ErrIncompatible = errors.New("sketch: sketches have different parameters")
+	// ErrBadEncoding is returned when unmarshaling data that isn't a sketch of that kind.
+	ErrBadEncoding = errors.New("sketch: bad encoding")
+)
+
+const encodingVersion = 1
+
+// hash64 is FNV-1a with a finalizer, since FNV alone leaves the high bits
+// poorly mixed for short keys and HyperLogLog indexes with them. It must
+// never change: encoded sketches depend on it.
+func hash64(item string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	x := h.Sum64()
+	// splitmix64 finalizer
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// putUint64 and friends keep the encoders short.
+func putUint64(data []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(data, v)
+}
+
+func putUint32(data []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(data, v)
+}
@@ -0,0 +1,226 @@
+package sketch
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+const topKMagic = "GLTK"
+
+// Entry is an item and its estimated count.
+type Entry struct {
+	Item  string
+	Count uint64
+}
+
+/* TopK tracks the k items with the highest counts. A CountMinSketch
+ * estimates every item's count and a min-heap of k entries holds the
+ * leaders, so memory stays fixed however many distinct items go by.
+ * Counts are CountMinSketch estimates, never below the truth.
+ */
+type TopK struct {
+	mu   sync.Mutex
+	k    int
+	cms  *CountMinSketch
+	heap entryHeap
+}
+
+// NewTopK tracks k items, with epsilon and delta as in NewCountMinSketch.
+func NewTopK(k int, epsilon, delta float64) *TopK {
+	if k < 1 {
+		k = 1
+	}
+	return &TopK{k: k, cms: NewCountMinSketch(epsilon, delta), heap: entryHeap{index: map[string]int{}}}
+}
+
+// Add counts item count more times.
+func (t *TopK) Add(item string, count uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offer(item, t.cms.Add(item, count))
+}
+
+// offer puts item in the heap if its estimate earns it a place.
+func (t *TopK) offer(item string, estimate uint64) {
+	if i, ok := t.heap.index[item]; ok {
+		t.heap.entries[i].Count = estimate
+		heap.Fix(&t.heap, i)
+		return
+	}
+	if t.heap.Len() < t.k {
+		heap.Push(&t.heap, Entry{item, estimate})
+		return
+	}
+	if estimate > t.heap.entries[0].Count {
+		delete(t.heap.index, t.heap.entries[0].Item)
+		t.heap.entries[0] = Entry{item, estimate}
+		t.heap.index[item] = 0
+		heap.Fix(&t.heap, 0)
+	}
+}
+
+// Top returns the tracked items, highest count first.
+func (t *TopK) Top() []Entry {
+	t.mu.Lock()
+	top := append([]Entry(nil), t.heap.entries...)
+	t.mu.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Item < top[j].Item
+	})
+	return top
+}
+
+// Count estimates how often item was added, tracked or not.
+func (t *TopK) Count(item string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cms.Count(item)
+}
+
+// Merge folds other in. Both need the same k, epsilon and delta. The
+// leaders are picked again from both sets using the merged counts.
+func (t *TopK) Merge(other *TopK) error {
+	// copy first, locking both at once could deadlock against other.Merge(t)
+	other.mu.Lock()
+	k := other.k
+	candidates := append([]Entry(nil), other.heap.entries...)
+	other.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if k != t.k {
+		return ErrIncompatible
+	}
+	if err := t.cms.Merge(other.cms); err != nil {
+		return err
+	}
+	candidates = append(candidates, t.heap.entries...)
+	t.heap.entries = nil
+	t.heap.index = map[string]int{}
+	for _, e := range candidates {
+		if _, ok := t.heap.index[e.Item]; !ok {
+			t.offer(e.Item, t.cms.Count(e.Item))
+		}
+	}
+	return nil
+}
+
+// MarshalBinary encodes magic, version, k, the CountMinSketch and the
+// tracked entries.
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cms, err := t.cms.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte(topKMagic), encodingVersion)
+	data = putUint32(data, uint32(t.k))
+	data = putUint32(data, uint32(len(cms)))
+	data = append(data, cms...)
+	data = putUint32(data, uint32(len(t.heap.entries)))
+	for _, e := range t.heap.entries {
+		data = putUint32(data, uint32(len(e.Item)))
+		data = append(data, e.Item...)
+		data = putUint64(data, e.Count)
+	}
+	return data, nil
+}
+
+func (t *TopK) UnmarshalBinary(data []byte) error {
+	if len(data) < len(topKMagic)+1 || string(data[:len(topKMagic)]) != topKMagic || data[4] != encodingVersion {
+		return ErrBadEncoding
+	}
+	r := reader{data: data[5:]}
+	k := int(r.uint32())
+	cms := &CountMinSketch{}
+	if err := cms.UnmarshalBinary(r.bytes(int(r.uint32()))); err != nil {
+		return err
+	}
+	n := int(r.uint32())
+	if r.err || k < 1 || n > k {
+		return ErrBadEncoding
+	}
+	h := entryHeap{index: map[string]int{}}
+	for i := 0; i < n; i++ {
+		item := string(r.bytes(int(r.uint32())))
+		if _, dup := h.index[item]; dup {
+			return ErrBadEncoding
+		}
+		h.index[item] = i
+		h.entries = append(h.entries, Entry{item, r.uint64()})
+	}
+	if r.err || len(r.data) != 0 {
+		return ErrBadEncoding
+	}
+	heap.Init(&h)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.k, t.cms, t.heap = k, cms, h
+	return nil
+}
+
+// reader decodes little-endian fields, remembering if it ran out of data.
+type reader struct {
+	data []byte
+	err  bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err || n < 0 || n > len(r.data) {
+		r.err = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// entryHeap is a min-heap on Count that knows where each item sits, so a
+// tracked item's count can be updated in place.
+type entryHeap struct {
+	entries []Entry
+	index   map[string]int
+}
+
+func (h entryHeap) Len() int           { return len(h.entries) }
+func (h entryHeap) Less(i, j int) bool { return h.entries[i].Count < h.entries[j].Count }
+
+func (h entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].Item] = i
+	h.index[h.entries[j].Item] = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(Entry)
+	h.index[e.Item] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.index, e.Item)
+	return e
+}
@@ -0,0 +1,57 @@
+package sketch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopKRoundTrip(t *testing.T) {
+	tk := NewTopK(3, 0.001, 0.01)
+	for item, count := range map[string]uint64{"r0": 50, "r1": 40, "r2": 30, "r3": 5} {
+		tk.Add(item, count)
+	}
+	data, err := tk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TopK
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Top(), tk.Top()) {
+		t.Fatalf("decoded Top() = %v, want %v", got.Top(), tk.Top())
+	}
+
+	// tracked items must be updated in place, not pushed again
+	for _, item := range []string{"r2", "r1", "r0"} {
+		got.Add(item, 1)
+		tk.Add(item, 1)
+	}
+	want := []Entry{{"r0", 51}, {"r1", 41}, {"r2", 31}}
+	if !reflect.DeepEqual(got.Top(), want) {
+		t.Errorf("Top() after Add = %v, want %v", got.Top(), want)
+	}
+	if !reflect.DeepEqual(tk.Top(), want) {
+		t.Errorf("original Top() after Add = %v, want %v", tk.Top(), want)
+	}
+}
+
+func TestTopKUnmarshalRejectsDuplicates(t *testing.T) {
+	tk := NewTopK(3, 0.001, 0.01)
+	tk.Add("a", 2)
+	tk.Add("b", 1)
+	data, err := tk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both items have one-byte names, so turning "b" into "a" is one byte
+	i := len(data) - 8 - 1
+	if data[i] != 'a' && data[i] != 'b' {
+		t.Fatalf("unexpected layout, byte %q", data[i])
+	}
+	data[i] ^= 'a' ^ 'b'
+	if err := new(TopK).UnmarshalBinary(data); err != ErrBadEncoding {
+		t.Errorf("got %v, want ErrBadEncoding", err)
+	}
+}
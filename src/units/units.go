@@ -0,0 +1,10 @@
+// Package units has the byte sizes logger and writers share, with the same
+// iota trick as KB/MB/GB in dataTypes/constants.go.
+package units
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
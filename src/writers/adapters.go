@@ -0,0 +1,131 @@
+package writers
+
+import (
+	"io"
+	"net/http"
+)
+
+/* Going from io to this package needs nothing for writing: any io.Writer
+ * is a Writer and any io.WriteCloser is a WriterCloser. The adapters
+ * below cover the gaps, i.e. missing or unusual Close methods and turning
+ * a WriterCloser stage into an io.Reader.
+ */
+
+// WriterFunc lets a plain function be a Writer.
+type WriterFunc func([]byte) (int, error)
+
+func (f WriterFunc) Write(data []byte) (int, error) {
+	return f(data)
+}
+
+// NopCloser makes w a WriterCloser whose Close does nothing, for things
+// like *bytes.Buffer or http.ResponseWriter that nobody should close.
+func NopCloser(w io.Writer) WriterCloser {
+	return nopCloser{w}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+/* FlushCloser makes w a WriterCloser whose Close flushes w first, so
+ * whatever w is holding back (a *bufio.Writer, a *gzip.Writer or an
+ * http.ResponseWriter streaming to the client) goes out. It then closes
+ * w if w is a Closer.
+ */
+func FlushCloser(w io.Writer) WriterCloser {
+	return flushCloser{w}
+}
+
+type flushCloser struct {
+	io.Writer
+}
+
+func (fc flushCloser) Close() error {
+	switch f := fc.Writer.(type) {
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	case http.Flusher:
+		f.Flush()
+	}
+	return closeIfCloser(fc.Writer)
+}
+
+// IOWriteCloser is the other direction: any Writer for code that wants an
+// io.WriteCloser, closing w only if it's a Closer.
+func IOWriteCloser(w Writer) io.WriteCloser {
+	if wc, ok := w.(WriterCloser); ok {
+		return wc
+	}
+	return nopCloser{w}
+}
+
+/* Pipe reads src through the WriterCloser stage returns, handing the
+ * output back as an io.Reader, e.g. to upload a compressed file without
+ * a temp file:
+ *
+ *	body := writers.Pipe(file, func(w writers.Writer) writers.WriterCloser {
+ *		return writers.NewBufferedWriterCloser(w, 64*1024, writers.FixedBytes)
+ *	})
+ *	http.Post(url, "application/octet-stream", body)
+ *
+ * Copying runs on its own Goroutine until src is exhausted or the reader
+ * is closed, so always close the result.
+ */
+func Pipe(src io.Reader, stage func(w Writer) WriterCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		wc := stage(pw)
+		_, err := io.Copy(wc, src)
+		if closeErr := wc.Close(); err == nil {
+			err = closeErr
+		}
+		// nil closes pw with io.EOF for the reader
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+/* ReadFrom is io.Copy's fast path: it reads r straight into the buffer and
+ * writes complete chunks downstream as they form, instead of going through
+ * io.Copy's own intermediate buffer. Like Write, it leaves incomplete
+ * chunks buffered for Flush or Close.
+ */
+func (bwc *BufferedWriterCloser) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		bwc.buffer.Grow(bwc.chunkSize)
+		n, err := bwc.buffer.ReadFrom(io.LimitReader(r, int64(bwc.chunkSize)))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if err := bwc.flush(false); err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, nil
+		}
+	}
+}
+
+/* WriteTo is the io.WriterTo side: it hands everything buffered to w
+ * instead of the downstream Writer, e.g. to move leftovers elsewhere, cut
+ * into chunks and framed exactly as Flush would. It returns how many
+ * bytes w took, length prefixes included. What w doesn't take stays
+ * buffered.
+ */
+func (bwc *BufferedWriterCloser) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	counted := WriterFunc(func(data []byte) (int, error) {
+		n, err := w.Write(data)
+		total += int64(n)
+		return n, err
+	})
+	err := bwc.flushTo(counted, true)
+	return total, err
+}
@@ -0,0 +1,109 @@
+package writers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ErrAborted is returned by writes to an AtomicFile after Abort.
+var ErrAborted = errors.New("writers: atomic file aborted")
+
+/* AtomicFile is an all-or-nothing file: writes go to a temp file next to
+ * path, which Close fsyncs and renames over path. Until then path keeps
+ * its old contents, and a crash or an Abort leaves it untouched.
+ *
+ *	af, err := writers.NewAtomicFile("config.json", 0644)
+ *	if err != nil {
+ *		return err
+ *	}
+ *	defer af.Abort() // no-op once Close succeeded
+ *	if err := json.NewEncoder(af).Encode(cfg); err != nil {
+ *		return err
+ *	}
+ *	return af.Close()
+ */
+type AtomicFile struct {
+	path string
+	perm os.FileMode
+	tmp  *os.File
+	err  error // set once committed or aborted
+}
+
+// NewAtomicFile creates the temp file. The temp file lives in path's
+// directory because a rename is only atomic within one file system.
+func NewAtomicFile(path string, perm os.FileMode) (*AtomicFile, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{path: path, perm: perm, tmp: tmp}, nil
+}
+
+func (af *AtomicFile) Write(data []byte) (int, error) {
+	if af.err != nil {
+		return 0, af.err
+	}
+	return af.tmp.Write(data)
+}
+
+// Close commits: everything written replaces path in one step. If that
+// fails, the temp file is removed and path is left as it was.
+func (af *AtomicFile) Close() error {
+	if af.err != nil {
+		return af.err
+	}
+	af.err = ErrClosed
+	if err := af.commit(); err != nil {
+		af.tmp.Close()
+		os.Remove(af.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (af *AtomicFile) commit() error {
+	// data first, then the rename, otherwise a crash could rename an empty file into place
+	if err := af.tmp.Chmod(af.perm); err != nil {
+		return err
+	}
+	if err := af.tmp.Sync(); err != nil {
+		return err
+	}
+	if err := af.tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(af.tmp.Name(), af.path); err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(af.path))
+}
+
+// Abort throws away everything written. It does nothing after Close.
+func (af *AtomicFile) Abort() error {
+	if af.err != nil {
+		return nil
+	}
+	af.err = ErrAborted
+	af.tmp.Close()
+	return os.Remove(af.tmp.Name())
+}
+
+// SyncDir makes renames and new files in dir durable, e.g. the rename in
+// AtomicFile.Close. Windows can't fsync a directory and doesn't need to.
+func SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
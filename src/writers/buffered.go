@@ -0,0 +1,180 @@
+package writers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf8"
+)
+
+/* Framing decides where BufferedWriterCloser cuts the buffer into the
+ * chunks it writes downstream, chunkSize being the most a chunk holds.
+ *
+ * - FixedBytes cuts every chunkSize bytes, wherever that lands
+ * - RuneSafe cuts at most chunkSize bytes but never inside a UTF-8 rune
+ * - NewlineDelimited writes whole lines, splitting only lines longer
+ *   than chunkSize
+ * - LengthPrefixed writes FixedBytes chunks, each preceded by its length
+ *   as a 4 byte big-endian integer, so the reader can find the boundaries
+ */
+type Framing int
+
+const (
+	FixedBytes Framing = iota
+	RuneSafe
+	NewlineDelimited
+	LengthPrefixed
+)
+
+// DefaultChunkSize is used when NewBufferedWriterCloser gets chunkSize <= 0.
+const DefaultChunkSize = 4096
+
+// BufferedWriterCloser collects writes and passes them to its downstream
+// Writer one chunk at a time.
+type BufferedWriterCloser struct {
+	buffer    *bytes.Buffer
+	w         Writer
+	chunkSize int
+	framing   Framing
+}
+
+func NewBufferedWriterCloser(w Writer, chunkSize int, framing Framing) *BufferedWriterCloser {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &BufferedWriterCloser{
+		buffer:    bytes.NewBuffer([]byte{}),
+		w:         w,
+		chunkSize: chunkSize,
+		framing:   framing,
+	}
+}
+
+// Write buffers data and writes downstream every chunk that is complete.
+// An error from downstream comes back with n == len(data): data is
+// buffered and will still be sent, so it mustn't be written again.
+func (bwc *BufferedWriterCloser) Write(data []byte) (int, error) {
+	n, err := bwc.buffer.Write(data)
+	if err != nil {
+		return n, err
+	}
+	return n, bwc.flush(false)
+}
+
+// Flush writes everything buffered downstream, complete chunk or not.
+func (bwc *BufferedWriterCloser) Flush() error {
+	return bwc.flush(true)
+}
+
+// Close flushes and then closes the downstream Writer if it's a Closer.
+func (bwc *BufferedWriterCloser) Close() error {
+	if err := bwc.flush(true); err != nil {
+		return err
+	}
+	return closeIfCloser(bwc.w)
+}
+
+// Buffered returns how many bytes are waiting for a complete chunk.
+func (bwc *BufferedWriterCloser) Buffered() int {
+	return bwc.buffer.Len()
+}
+
+func (bwc *BufferedWriterCloser) flush(all bool) error {
+	return bwc.flushTo(bwc.w, all)
+}
+
+// flushTo writes the chunks to w, which is the downstream Writer except
+// in WriteTo.
+func (bwc *BufferedWriterCloser) flushTo(w Writer, all bool) error {
+	for bwc.buffer.Len() > 0 {
+		n := bwc.nextChunk(all)
+		if n == 0 {
+			return nil
+		}
+		// the chunk leaves the buffer only once it's downstream, so a
+		// failed write is retried by the next Write, Flush or Close
+		written, err := bwc.writeChunk(w, bwc.buffer.Bytes()[:n])
+		bwc.buffer.Next(written)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextChunk returns the size of the next chunk, 0 if it isn't complete yet.
+func (bwc *BufferedWriterCloser) nextChunk(all bool) int {
+	data := bwc.buffer.Bytes()
+	// once chunkSize bytes are in, more data can't change where the chunk ends
+	full := len(data) >= bwc.chunkSize
+	size := bwc.chunkSize
+	if size > len(data) {
+		size = len(data)
+	}
+
+	switch bwc.framing {
+	case NewlineDelimited:
+		if i := bytes.IndexByte(data[:size], '\n'); i >= 0 {
+			return i + 1
+		}
+	case RuneSafe:
+		if !full && !all {
+			return 0
+		}
+		if n := runeBoundary(data, bwc.chunkSize); n > 0 {
+			return n
+		}
+		if !all {
+			return 0
+		}
+	}
+
+	if full || all {
+		return size
+	}
+	return 0
+}
+
+/* runeBoundary returns how many bytes of data, at most size, end on a
+ * complete rune, 0 if the first rune isn't complete yet. A single rune
+ * longer than size comes back whole.
+ */
+func runeBoundary(data []byte, size int) int {
+	n := 0
+	for n < len(data) && utf8.FullRune(data[n:]) {
+		_, runeSize := utf8.DecodeRune(data[n:])
+		if n+runeSize > size {
+			if n == 0 {
+				return runeSize
+			}
+			break
+		}
+		n += runeSize
+	}
+	return n
+}
+
+/* writeChunk returns how many bytes of chunk went downstream. A short
+ * write without an error is io.ErrShortWrite. A length-prefixed chunk
+ * counts as written only whole: resending part of a frame can't repair
+ * the stream anyway, so it's resent from its prefix.
+ */
+func (bwc *BufferedWriterCloser) writeChunk(w Writer, chunk []byte) (int, error) {
+	frame := chunk
+	if bwc.framing == LengthPrefixed {
+		frame = make([]byte, 4+len(chunk))
+		binary.BigEndian.PutUint32(frame, uint32(len(chunk)))
+		copy(frame[4:], chunk)
+	}
+	n, err := w.Write(frame)
+	if err == nil && n < len(frame) {
+		err = io.ErrShortWrite
+	}
+	if bwc.framing == LengthPrefixed {
+		if n == len(frame) {
+			return len(chunk), err
+		}
+		return 0, err
+	}
+	return n, err
+}
@@ -0,0 +1,85 @@
+package writers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// flakyWriter fails as many writes as failures says, then writes at most max
+// bytes per call when max > 0.
+type flakyWriter struct {
+	bytes.Buffer
+	failures int
+	max      int
+}
+
+var errFlaky = errors.New("flaky")
+
+func (fw *flakyWriter) Write(data []byte) (int, error) {
+	if fw.failures > 0 {
+		fw.failures--
+		return 0, errFlaky
+	}
+	if fw.max > 0 && len(data) > fw.max {
+		data = data[:fw.max]
+	}
+	return fw.Buffer.Write(data)
+}
+
+func TestBufferedRetriesFailedChunk(t *testing.T) {
+	for _, framing := range []Framing{FixedBytes, RuneSafe, NewlineDelimited, LengthPrefixed} {
+		fw := &flakyWriter{failures: 1}
+		bwc := NewBufferedWriterCloser(fw, 4, framing)
+		if n, err := bwc.Write([]byte("abcd\nefgh\n")); n != 10 || err != errFlaky {
+			t.Fatalf("framing %d: Write = %d, %v, want 10, %v", framing, n, err, errFlaky)
+		}
+		if err := bwc.Close(); err != nil {
+			t.Fatalf("framing %d: Close = %v", framing, err)
+		}
+
+		want := &flakyWriter{}
+		ref := NewBufferedWriterCloser(want, 4, framing)
+		ref.Write([]byte("abcd\nefgh\n"))
+		ref.Close()
+		if fw.String() != want.String() {
+			t.Errorf("framing %d: wrote %q, want %q", framing, fw.String(), want.String())
+		}
+	}
+}
+
+func TestBufferedShortWrite(t *testing.T) {
+	fw := &flakyWriter{max: 3}
+	bwc := NewBufferedWriterCloser(fw, 4, FixedBytes)
+	if _, err := bwc.Write([]byte("abcdefgh")); err != io.ErrShortWrite {
+		t.Fatalf("Write = %v, want %v", err, io.ErrShortWrite)
+	}
+	fw.max = 0
+	if err := bwc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fw.String(); got != "abcdefgh" {
+		t.Errorf("wrote %q, want %q", got, "abcdefgh")
+	}
+}
+
+func TestBufferedWriteToFrames(t *testing.T) {
+	var downstream, elsewhere bytes.Buffer
+	bwc := NewBufferedWriterCloser(&downstream, 4, LengthPrefixed)
+	bwc.Write([]byte("abcdef"))
+
+	n, err := bwc.WriteTo(&elsewhere)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x00\x00\x00\x02ef"; elsewhere.String() != want || n != int64(len(want)) {
+		t.Errorf("WriteTo wrote %q (n = %d), want %q", elsewhere.String(), n, want)
+	}
+	if want := "\x00\x00\x00\x04abcd"; downstream.String() != want {
+		t.Errorf("downstream got %q, want %q", downstream.String(), want)
+	}
+	if bwc.Buffered() != 0 {
+		t.Errorf("%d bytes still buffered", bwc.Buffered())
+	}
+}
@@ -0,0 +1,165 @@
+package writers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// HashAlgorithm picks what a ChecksumWriter computes.
+type HashAlgorithm int
+
+const (
+	CRC32    HashAlgorithm = iota // IEEE
+	SHA256                        // for when corruption might not be accidental
+	XXHash64                      // fastest, seed 0
+)
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case CRC32:
+		return "crc32"
+	case SHA256:
+		return "sha256"
+	case XXHash64:
+		return "xxhash64"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(a))
+}
+
+func (a HashAlgorithm) new() (hash.Hash, error) {
+	switch a {
+	case CRC32:
+		return crc32.NewIEEE(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case XXHash64:
+		return newXXHash64(), nil
+	}
+	return nil, fmt.Errorf("writers: unknown hash algorithm %v", a)
+}
+
+/* With a trailer, a ChecksumWriter ends the stream with
+ *
+ *	"GLCK" | algorithm (1) | digest
+ *
+ * which ChecksumReader strips and checks.
+ */
+const checksumMagic = "GLCK"
+
+// ErrChecksum is returned by ChecksumReader when the data doesn't match its trailer.
+var ErrChecksum = errors.New("writers: checksum mismatch")
+
+// ChecksumWriter hashes everything written through it to its downstream Writer.
+type ChecksumWriter struct {
+	w       Writer
+	alg     HashAlgorithm
+	h       hash.Hash
+	trailer bool
+	sum     []byte
+}
+
+// NewChecksumWriter hashes with alg, appending a trailer on Close if asked.
+func NewChecksumWriter(w Writer, alg HashAlgorithm, trailer bool) (*ChecksumWriter, error) {
+	h, err := alg.new()
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumWriter{w: w, alg: alg, h: h, trailer: trailer}, nil
+}
+
+func (cw *ChecksumWriter) Write(data []byte) (int, error) {
+	if cw.sum != nil {
+		return 0, ErrClosed
+	}
+	n, err := cw.w.Write(data)
+	// only what actually went downstream counts
+	cw.h.Write(data[:n])
+	return n, err
+}
+
+// Close fixes the digest, writes the trailer if asked and closes the
+// downstream Writer if it's a Closer.
+func (cw *ChecksumWriter) Close() error {
+	if cw.sum != nil {
+		return ErrClosed
+	}
+	cw.sum = cw.h.Sum(nil)
+	if cw.trailer {
+		t := append([]byte(checksumMagic), byte(cw.alg))
+		if _, err := cw.w.Write(append(t, cw.sum...)); err != nil {
+			return err
+		}
+	}
+	return closeIfCloser(cw.w)
+}
+
+// Sum returns the digest, nil until Close.
+func (cw *ChecksumWriter) Sum() []byte {
+	return cw.sum
+}
+
+/* ChecksumReader reads a stream written by a ChecksumWriter with a
+ * trailer. It holds back as many bytes as a trailer takes, so it never
+ * hands the trailer out as data, and at the end returns ErrChecksum
+ * instead of io.EOF if the trailer doesn't match.
+ */
+type ChecksumReader struct {
+	r    io.Reader
+	alg  HashAlgorithm
+	h    hash.Hash
+	tail int    // trailer size
+	buf  []byte // read but not handed out yet
+	eof  bool
+	err  error
+}
+
+func NewChecksumReader(r io.Reader, alg HashAlgorithm) (*ChecksumReader, error) {
+	h, err := alg.new()
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumReader{r: r, alg: alg, h: h, tail: len(checksumMagic) + 1 + h.Size()}, nil
+}
+
+func (cr *ChecksumReader) Read(data []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	// read ahead until there's something beyond a trailer's worth
+	for !cr.eof && len(cr.buf) <= cr.tail {
+		chunk := make([]byte, len(data)+cr.tail)
+		n, err := cr.r.Read(chunk)
+		cr.buf = append(cr.buf, chunk[:n]...)
+		if err == io.EOF {
+			cr.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if len(cr.buf) <= cr.tail {
+		cr.err = cr.verify()
+		return 0, cr.err
+	}
+	n := copy(data, cr.buf[:len(cr.buf)-cr.tail])
+	cr.h.Write(data[:n])
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// Sum returns the digest of the data read so far.
+func (cr *ChecksumReader) Sum() []byte {
+	return cr.h.Sum(nil)
+}
+
+func (cr *ChecksumReader) verify() error {
+	want := append(append([]byte(checksumMagic), byte(cr.alg)), cr.h.Sum(nil)...)
+	if !bytes.Equal(cr.buf, want) {
+		return ErrChecksum
+	}
+	return io.EOF
+}
@@ -0,0 +1,128 @@
+package writers
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Compression picks the stream format of a compressing stage.
+type Compression int
+
+const (
+	Gzip Compression = iota
+	Zlib
+	Deflate // raw DEFLATE, no header or checksum
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	case Deflate:
+		return "deflate"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// compressor is what gzip.Writer, zlib.Writer and flate.Writer have in common.
+type compressor interface {
+	WriterCloser
+	Flush() error
+}
+
+/* CompressWriter compresses everything written through it into w. Close
+ * writes the end of the stream (checksum and all) and then closes w if it
+ * is a Closer, so a stack of stages closes in one call:
+ *
+ *	f, _ := os.Create("export.gz")
+ *	wc, _ := writers.NewCompressWriter(f, writers.Gzip, gzip.BestSpeed)
+ *	defer wc.Close() // finishes the gzip stream, then closes f
+ */
+type CompressWriter struct {
+	w  Writer
+	zw compressor
+}
+
+// NewCompressWriter starts a stream; level is one of compress/flate's
+// levels, e.g. flate.DefaultCompression.
+func NewCompressWriter(w Writer, c Compression, level int) (*CompressWriter, error) {
+	var zw compressor
+	var err error
+	switch c {
+	case Gzip:
+		zw, err = gzip.NewWriterLevel(w, level)
+	case Zlib:
+		zw, err = zlib.NewWriterLevel(w, level)
+	case Deflate:
+		zw, err = flate.NewWriter(w, level)
+	default:
+		return nil, fmt.Errorf("writers: unknown compression %v", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CompressWriter{w: w, zw: zw}, nil
+}
+
+func (cw *CompressWriter) Write(data []byte) (int, error) {
+	return cw.zw.Write(data)
+}
+
+// Flush pushes out everything compressed so far without ending the stream,
+// e.g. before a long pause on a network connection.
+func (cw *CompressWriter) Flush() error {
+	return cw.zw.Flush()
+}
+
+func (cw *CompressWriter) Close() error {
+	if err := cw.zw.Close(); err != nil {
+		return err
+	}
+	return closeIfCloser(cw.w)
+}
+
+/* DecompressReader is CompressWriter in reverse, reading the stream back
+ * from r. Close releases the decompressor and closes r if it's a Closer.
+ */
+type DecompressReader struct {
+	r  io.Reader
+	zr io.ReadCloser
+}
+
+func NewDecompressReader(r io.Reader, c Compression) (*DecompressReader, error) {
+	var zr io.ReadCloser
+	var err error
+	switch c {
+	case Gzip:
+		zr, err = gzip.NewReader(r)
+	case Zlib:
+		zr, err = zlib.NewReader(r)
+	case Deflate:
+		zr = flate.NewReader(r)
+	default:
+		return nil, fmt.Errorf("writers: unknown compression %v", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &DecompressReader{r: r, zr: zr}, nil
+}
+
+func (dr *DecompressReader) Read(data []byte) (int, error) {
+	return dr.zr.Read(data)
+}
+
+func (dr *DecompressReader) Close() error {
+	if err := dr.zr.Close(); err != nil {
+		return err
+	}
+	if c, ok := dr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package writers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/tjapit/go-learn/src/units"
+)
+
+/* Stream layout of EncryptWriter, all integers big-endian:
+ *
+ *	header: "GLAE" | version (1) | chunk size (4) | nonce prefix (7)
+ *	chunk:  last bit + sealed length (4) | AES-GCM sealed chunk
+ *
+ * Every chunk's nonce is the prefix, the chunk's index (4) and a last
+ * flag (1), and the header is its additional data. So reordering, dropping
+ * or editing chunks, editing the header, cutting the stream short or
+ * appending to it all fail authentication. The last chunk is the trailer,
+ * written by Close even when it holds no data.
+ */
+const (
+	encryptMagic      = "GLAE"
+	encryptVersion    = 1
+	encryptPrefixSize = 7
+	encryptHeaderSize = len(encryptMagic) + 1 + 4 + encryptPrefixSize
+	lastChunkBit      = 1 << 31
+)
+
+var (
+	ErrBadHeader = errors.New("writers: not an encrypted stream")
+	ErrTampered  = errors.New("writers: encrypted stream was tampered with")
+	ErrTruncated = errors.New("writers: encrypted stream is truncated")
+	ErrTooLong   = errors.New("writers: encrypted stream is too long")
+)
+
+// EncryptWriter encrypts and authenticates everything written through it.
+type EncryptWriter struct {
+	w      Writer
+	aead   cipher.AEAD
+	header []byte
+	chunk  []byte // plaintext waiting for a full chunk
+	size   int
+	index  uint32
+	err    error
+}
+
+/* NewEncryptWriter starts a stream into w. key is 16, 24 or 32 bytes for
+ * AES-128, -192 or -256, chunkSize <= 0 uses DefaultChunkSize. Close must
+ * be called, without the trailer the reader rejects the stream.
+ *
+ * Behind a BufferedWriterCloser, nothing reaches disk in plaintext:
+ *
+ *	ew, _ := writers.NewEncryptWriter(file, key, 64*units.KB)
+ *	wc := writers.NewBufferedWriterCloser(ew, 4096, writers.FixedBytes)
+ */
+func NewEncryptWriter(w Writer, key []byte, chunkSize int) (*EncryptWriter, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptHeaderSize)
+	copy(header, encryptMagic)
+	header[4] = encryptVersion
+	binary.BigEndian.PutUint32(header[5:], uint32(chunkSize))
+	if _, err := rand.Read(header[9:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &EncryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		chunk:  make([]byte, 0, chunkSize),
+		size:   chunkSize,
+	}, nil
+}
+
+func (ew *EncryptWriter) Write(data []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	written := 0
+	for len(data) > 0 {
+		n := ew.size - len(ew.chunk)
+		if n > len(data) {
+			n = len(data)
+		}
+		ew.chunk = append(ew.chunk, data[:n]...)
+		data = data[n:]
+		written += n
+		// only seal a full chunk once more data shows it isn't the last one
+		if len(ew.chunk) == ew.size && len(data) > 0 {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the final chunk and the downstream Writer is closed if it's a Closer.
+func (ew *EncryptWriter) Close() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	if len(ew.chunk) == ew.size {
+		if err := ew.seal(false); err != nil {
+			return err
+		}
+	}
+	if err := ew.seal(true); err != nil {
+		return err
+	}
+	ew.err = ErrClosed
+	return closeIfCloser(ew.w)
+}
+
+func (ew *EncryptWriter) seal(last bool) error {
+	if ew.index == ^uint32(0) {
+		ew.err = ErrTooLong
+		return ew.err
+	}
+	nonce := chunkNonce(ew.header, ew.index, last)
+	frame := make([]byte, 4, 4+len(ew.chunk)+ew.aead.Overhead())
+	frame = ew.aead.Seal(frame, nonce, ew.chunk, ew.header)
+	length := uint32(len(frame) - 4)
+	if last {
+		length |= lastChunkBit
+	}
+	binary.BigEndian.PutUint32(frame, length)
+	if _, err := ew.w.Write(frame); err != nil {
+		ew.err = err
+		return err
+	}
+	ew.index++
+	ew.chunk = ew.chunk[:0]
+	return nil
+}
+
+// DecryptReader reads back what EncryptWriter wrote, failing on any change.
+type DecryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	size   int
+	index  uint32
+	plain  []byte // decrypted, not yet read
+	done   bool   // trailer seen
+	err    error
+}
+
+// NewDecryptReader reads and checks the header from r.
+func NewDecryptReader(r io.Reader, key []byte) (*DecryptReader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrBadHeader
+	}
+	if string(header[:4]) != encryptMagic || header[4] != encryptVersion {
+		return nil, ErrBadHeader
+	}
+	size := int(binary.BigEndian.Uint32(header[5:]))
+	if size <= 0 || size > 64*units.MB {
+		return nil, ErrBadHeader
+	}
+	return &DecryptReader{r: r, aead: aead, header: header, size: size}, nil
+}
+
+func (dr *DecryptReader) Read(data []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.done {
+			dr.err = dr.checkEnd()
+			continue
+		}
+		dr.err = dr.open()
+	}
+	n := copy(data, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (dr *DecryptReader) open() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(dr.r, prefix[:]); err != nil {
+		return truncated(err)
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	last := length&lastChunkBit != 0
+	length &^= lastChunkBit
+	if int(length) > dr.size+dr.aead.Overhead() {
+		return ErrTampered
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(dr.r, sealed); err != nil {
+		return truncated(err)
+	}
+	plain, err := dr.aead.Open(sealed[:0], chunkNonce(dr.header, dr.index, last), sealed, dr.header)
+	if err != nil {
+		return ErrTampered
+	}
+	dr.index++
+	dr.plain = plain
+	dr.done = last
+	return nil
+}
+
+// checkEnd makes sure nothing follows the trailer.
+func (dr *DecryptReader) checkEnd() error {
+	var extra [1]byte
+	if n, _ := io.ReadFull(dr.r, extra[:]); n > 0 {
+		return ErrTampered
+	}
+	return io.EOF
+}
+
+// Close closes the source if it's a Closer.
+func (dr *DecryptReader) Close() error {
+	if c, ok := dr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(header []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[9:])
+	binary.BigEndian.PutUint32(nonce[7:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
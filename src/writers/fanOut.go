@@ -0,0 +1,203 @@
+package writers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+/* FanOutMode decides when a FanOut write counts as failed.
+ *
+ * - FailFast fails as soon as any sink fails
+ * - BestEffort fails only when every sink has failed
+ * - Quorum fails when fewer than Quorum sinks took the write
+ *
+ * Whatever the mode, a sink that failed once is cut off and skipped from
+ * then on, so one broken destination can't keep slowing down the others.
+ * In FailFast mode that also means every later write fails right away.
+ */
+type FanOutMode int
+
+const (
+	FailFast FanOutMode = iota
+	BestEffort
+	Quorum
+)
+
+type FanOutConfig struct {
+	Mode       FanOutMode
+	Quorum     int  // used by Quorum mode, below 1 means a majority of sinks
+	Concurrent bool // write to all sinks at once instead of one by one
+}
+
+// SinkError is a failure of the sink at Index in the FanOut.
+type SinkError struct {
+	Index int
+	Err   error
+}
+
+func (se SinkError) Error() string {
+	return fmt.Sprintf("sink %d: %v", se.Index, se.Err)
+}
+
+// FanOutError lists the sinks that are cut off, or that failed to Close.
+type FanOutError struct {
+	Errors    []SinkError
+	Succeeded int
+}
+
+func (fe *FanOutError) Error() string {
+	msgs := make([]string, len(fe.Errors))
+	for i, se := range fe.Errors {
+		msgs[i] = se.Error()
+	}
+	return fmt.Sprintf("writers: %d sink(s) ok, failed: %s", fe.Succeeded, strings.Join(msgs, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As look at every sink's error.
+func (fe *FanOutError) Unwrap() []error {
+	errs := make([]error, len(fe.Errors))
+	for i, se := range fe.Errors {
+		errs[i] = se.Err
+	}
+	return errs
+}
+
+// FanOut is a WriterCloser duplicating every write to all of its sinks.
+type FanOut struct {
+	cfg   FanOutConfig
+	sinks []Writer
+
+	mu     sync.Mutex // one write at a time, guards failed
+	failed []error    // sticky, per sink
+}
+
+// NewFanOut fails if Quorum mode asks for more sinks than it's given,
+// since no write could ever succeed.
+func NewFanOut(cfg FanOutConfig, sinks ...Writer) (*FanOut, error) {
+	if cfg.Mode == Quorum {
+		if cfg.Quorum < 1 {
+			cfg.Quorum = len(sinks)/2 + 1
+		}
+		if cfg.Quorum > len(sinks) {
+			return nil, fmt.Errorf("writers: quorum of %d with only %d sinks", cfg.Quorum, len(sinks))
+		}
+	}
+	return &FanOut{cfg: cfg, sinks: sinks, failed: make([]error, len(sinks))}, nil
+}
+
+// Errors returns the error that cut off each sink, nil for healthy ones.
+func (fo *FanOut) Errors() []error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	return append([]error(nil), fo.failed...)
+}
+
+func (fo *FanOut) Write(data []byte) (int, error) {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	err := fo.each(func(w Writer) error {
+		n, err := w.Write(data)
+		if err == nil && n < len(data) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close closes every sink that is a Closer, failed or not, and judges the
+// outcome by the same mode as writes.
+func (fo *FanOut) Close() error {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	var errs []SinkError
+	for i, w := range fo.sinks {
+		if err := closeIfCloser(w); err != nil {
+			errs = append(errs, SinkError{i, err})
+		}
+	}
+	return fo.judge(len(fo.sinks)-len(errs), errs)
+}
+
+// each runs op on every healthy sink, cuts off the ones that fail and
+// judges the result.
+func (fo *FanOut) each(op func(Writer) error) error {
+	if fo.cfg.Mode == FailFast {
+		if errs := fo.failedErrors(); len(errs) > 0 {
+			return &FanOutError{Errors: errs}
+		}
+	}
+	results := make([]error, len(fo.sinks))
+	attempted := make([]bool, len(fo.sinks))
+
+	if fo.cfg.Concurrent {
+		var wg sync.WaitGroup
+		for i, w := range fo.sinks {
+			if fo.failed[i] != nil {
+				continue
+			}
+			attempted[i] = true
+			wg.Add(1)
+			// pass i and w in, don't close over the loop variables
+			go func(i int, w Writer) {
+				defer wg.Done()
+				results[i] = op(w)
+			}(i, w)
+		}
+		wg.Wait()
+	} else {
+		for i, w := range fo.sinks {
+			if fo.failed[i] != nil {
+				continue
+			}
+			attempted[i] = true
+			results[i] = op(w)
+			if results[i] != nil && fo.cfg.Mode == FailFast {
+				break
+			}
+		}
+	}
+
+	succeeded := 0
+	for i, err := range results {
+		switch {
+		case !attempted[i]:
+		case err != nil:
+			fo.failed[i] = err
+		default:
+			succeeded++
+		}
+	}
+	return fo.judge(succeeded, fo.failedErrors())
+}
+
+func (fo *FanOut) failedErrors() []SinkError {
+	var errs []SinkError
+	for i, err := range fo.failed {
+		if err != nil {
+			errs = append(errs, SinkError{i, err})
+		}
+	}
+	return errs
+}
+
+func (fo *FanOut) judge(succeeded int, errs []SinkError) error {
+	var failed bool
+	switch fo.cfg.Mode {
+	case FailFast:
+		failed = len(errs) > 0
+	case BestEffort:
+		failed = succeeded == 0 && len(fo.sinks) > 0
+	case Quorum:
+		failed = succeeded < fo.cfg.Quorum
+	}
+	if !failed {
+		return nil
+	}
+	return &FanOutError{Errors: errs, Succeeded: succeeded}
+}
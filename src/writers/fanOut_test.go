@@ -0,0 +1,24 @@
+package writers
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewFanOutQuorum(t *testing.T) {
+	var a, b bytes.Buffer
+	tests := []struct {
+		quorum int
+		ok     bool
+	}{
+		{0, true}, // a majority of 2 is 2
+		{2, true},
+		{3, false},
+	}
+	for _, tt := range tests {
+		fo, err := NewFanOut(FanOutConfig{Mode: Quorum, Quorum: tt.quorum}, &a, &b)
+		if (err == nil) != tt.ok || (fo != nil) != tt.ok {
+			t.Errorf("quorum %d: NewFanOut = %v, %v", tt.quorum, fo, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package writers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/* LimitedWriter caps throughput to its downstream Writer with a token
+ * bucket: the bucket fills at bytesPerSec and holds up to burst bytes, and
+ * every byte written takes a token, waiting for one if the bucket is
+ * empty. Writes larger than burst go out in burst-sized pieces.
+ *
+ *	lw := writers.NewLimitedWriter(ctx, conn, 2*units.MB, 256*units.KB)
+ *
+ * It's safe for concurrent use, the Goroutines share the one budget.
+ */
+type LimitedWriter struct {
+	ctx   context.Context
+	w     Writer
+	rate  float64 // bytes per second
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimitedWriter starts with a full bucket. ctx bounds every Write;
+// WriteContext takes a different one per call. bytesPerSec <= 0 means
+// unlimited, and burst <= 0 means one second's worth.
+func NewLimitedWriter(ctx context.Context, w Writer, bytesPerSec, burst int) *LimitedWriter {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &LimitedWriter{
+		ctx:    ctx,
+		w:      w,
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (lw *LimitedWriter) Write(data []byte) (int, error) {
+	return lw.WriteContext(lw.ctx, data)
+}
+
+// WriteContext is Write, giving up with ctx.Err() if ctx is done while
+// waiting for tokens. What was written until then is counted in n.
+func (lw *LimitedWriter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if lw.rate <= 0 {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return lw.w.Write(data)
+	}
+	written := 0
+	for len(data) > 0 {
+		n := len(data)
+		if n > lw.burst {
+			n = lw.burst
+		}
+		if err := lw.wait(ctx, n); err != nil {
+			return written, err
+		}
+		m, err := lw.w.Write(data[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// Close closes the downstream Writer if it's a Closer.
+func (lw *LimitedWriter) Close() error {
+	return closeIfCloser(lw.w)
+}
+
+// wait takes n tokens, sleeping until the bucket has refilled enough.
+func (lw *LimitedWriter) wait(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lw.mu.Lock()
+	now := time.Now()
+	lw.tokens += now.Sub(lw.last).Seconds() * lw.rate
+	if lw.tokens > float64(lw.burst) {
+		lw.tokens = float64(lw.burst)
+	}
+	lw.last = now
+	// reserve now, even into debt, so concurrent writers queue up fairly
+	lw.tokens -= float64(n)
+	debt := -lw.tokens
+	lw.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(debt / lw.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// hand the reservation back, nothing was written
+		lw.mu.Lock()
+		lw.tokens += float64(n)
+		lw.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,159 @@
+package writers
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/tjapit/go-learn/src/units"
+)
+
+// MaxLineBytes is the longest line a line mode RingWriter keeps whole.
+const MaxLineBytes = 64 * units.KB
+
+/* RingWriter keeps only the most recent output: the last N bytes, or the
+ * last N lines, overwriting the oldest. Put it next to the real
+ * destination and attach a Snapshot to crash reports, e.g. in the
+ * recover path from controlFlow/recover.go:
+ *
+ *	recent := writers.NewRingWriter(64 * units.KB)
+ *	out, _ := writers.NewFanOut(writers.FanOutConfig{Mode: writers.BestEffort}, os.Stdout, recent) // only Quorum can fail
+ *	defer func() {
+ *		if err := recover(); err != nil {
+ *			log.Printf("Error: %v\nlast output:\n%s", err, recent.Snapshot())
+ *		}
+ *	}()
+ *
+ * Writers and readers can use it from any number of Goroutines.
+ */
+type RingWriter struct {
+	mu sync.Mutex
+
+	// byte mode
+	buf   []byte
+	start int // oldest byte
+	size  int
+
+	// line mode
+	maxLines int
+	lines    [][]byte // ring of complete lines, '\n' included
+	first    int      // oldest line
+	partial  []byte   // current line, not terminated yet
+}
+
+// NewRingWriter keeps the last maxBytes bytes.
+func NewRingWriter(maxBytes int) *RingWriter {
+	if maxBytes < 1 {
+		maxBytes = 1
+	}
+	return &RingWriter{buf: make([]byte, maxBytes)}
+}
+
+// NewLineRingWriter keeps the last maxLines lines, counting an unfinished
+// last line as one of them. Of a line longer than MaxLineBytes only the
+// last MaxLineBytes are kept, so output that never ends a line, like a
+// progress bar redrawn with "\r", can't grow it without bound.
+func NewLineRingWriter(maxLines int) *RingWriter {
+	if maxLines < 1 {
+		maxLines = 1
+	}
+	return &RingWriter{maxLines: maxLines}
+}
+
+func (rw *RingWriter) Write(data []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.maxLines > 0 {
+		rw.writeLines(data)
+	} else {
+		rw.writeBytes(data)
+	}
+	return len(data), nil
+}
+
+func (rw *RingWriter) writeBytes(data []byte) {
+	capacity := len(rw.buf)
+	// anything older than the last capacity bytes would be overwritten anyway
+	if len(data) >= capacity {
+		copy(rw.buf, data[len(data)-capacity:])
+		rw.start, rw.size = 0, capacity
+		return
+	}
+	end := (rw.start + rw.size) % capacity
+	n := copy(rw.buf[end:], data)
+	copy(rw.buf, data[n:])
+	rw.size += len(data)
+	if rw.size > capacity {
+		rw.start = (rw.start + rw.size - capacity) % capacity
+		rw.size = capacity
+	}
+}
+
+func (rw *RingWriter) writeLines(data []byte) {
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			rw.partial = appendTail(rw.partial, data)
+			return
+		}
+		line := appendTail(rw.partial, data[:i+1])
+		rw.partial = nil
+		data = data[i+1:]
+		if len(rw.lines) < rw.maxLines {
+			rw.lines = append(rw.lines, line)
+		} else {
+			rw.lines[rw.first] = line
+			rw.first = (rw.first + 1) % rw.maxLines
+		}
+	}
+}
+
+// appendTail appends data to line and keeps the last MaxLineBytes bytes.
+func appendTail(line, data []byte) []byte {
+	if len(data) >= MaxLineBytes {
+		return append(line[:0], data[len(data)-MaxLineBytes:]...)
+	}
+	line = append(line, data...)
+	if over := len(line) - MaxLineBytes; over > 0 {
+		line = line[:copy(line, line[over:])]
+	}
+	return line
+}
+
+// Snapshot returns a copy of what the ring holds, oldest first.
+func (rw *RingWriter) Snapshot() []byte {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.maxLines == 0 {
+		out := make([]byte, 0, rw.size)
+		end := rw.start + rw.size
+		if end <= len(rw.buf) {
+			return append(out, rw.buf[rw.start:end]...)
+		}
+		out = append(out, rw.buf[rw.start:]...)
+		return append(out, rw.buf[:end-len(rw.buf)]...)
+	}
+
+	var out []byte
+	skip := 0
+	// the unfinished line pushes the oldest complete one out
+	if len(rw.partial) > 0 && len(rw.lines) == rw.maxLines {
+		skip = 1
+	}
+	for i := skip; i < len(rw.lines); i++ {
+		out = append(out, rw.lines[(rw.first+i)%len(rw.lines)]...)
+	}
+	return append(out, rw.partial...)
+}
+
+// String is Snapshot as a string, so a RingWriter prints with fmt.
+func (rw *RingWriter) String() string {
+	return string(rw.Snapshot())
+}
+
+// Reset forgets everything.
+func (rw *RingWriter) Reset() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.start, rw.size = 0, 0
+	rw.lines, rw.first, rw.partial = nil, 0, nil
+}
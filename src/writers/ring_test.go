@@ -0,0 +1,26 @@
+package writers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineRingLongLine(t *testing.T) {
+	rw := NewLineRingWriter(2)
+	for i := 0; i < 2*MaxLineBytes/len("progress\r"); i++ {
+		rw.Write([]byte("progress\r"))
+	}
+	if n := len(rw.Snapshot()); n != MaxLineBytes {
+		t.Fatalf("unfinished line holds %d bytes, want %d", n, MaxLineBytes)
+	}
+	if !bytes.HasSuffix(rw.Snapshot(), []byte("progress\r")) {
+		t.Error("the newest bytes were dropped instead of the oldest")
+	}
+
+	rw.Write([]byte("done\nnext\n"))
+	snap := rw.String()
+	if !strings.HasSuffix(snap, "progress\rdone\nnext\n") || len(snap) != MaxLineBytes+len("next\n") {
+		t.Errorf("after finishing the line, snapshot is %d bytes ending %q", len(snap), snap[len(snap)-20:])
+	}
+}
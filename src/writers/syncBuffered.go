@@ -0,0 +1,180 @@
+package writers
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by writes to a WriterCloser that was already closed.
+var ErrClosed = errors.New("writers: write after close")
+
+// FrontLimit caps a SyncBufferedWriterCloser's front buffer at this many
+// times its threshold.
+const FrontLimit = 4
+
+/* SyncBufferedWriterCloser is BufferedWriterCloser for many Goroutines.
+ *
+ * Writes only append to a front buffer under a mutex, so they don't wait
+ * on the downstream Writer. A background Goroutine moves the front buffer
+ * into the BufferedWriterCloser it wraps, which does the chunking, once
+ * the front buffer holds threshold bytes and every interval no matter
+ * what. The first downstream error sticks: later writes return it and so
+ * does Close.
+ *
+ * When downstream falls behind, the front buffer stops growing at
+ * FrontLimit * threshold bytes and writes block until the Goroutine takes
+ * it, like a full channel, rather than dropping data or failing.
+ */
+type SyncBufferedWriterCloser struct {
+	threshold int
+
+	mu     sync.Mutex // guards front, err and closed
+	room   *sync.Cond // signalled when front is taken, err set or closed
+	front  *bytes.Buffer
+	err    error
+	closed bool
+
+	flushMu sync.Mutex // serialises downstream writes
+	back    *BufferedWriterCloser
+
+	kickCh    chan struct{}
+	doneCh    chan struct{}
+	stoppedCh chan struct{}
+}
+
+// NewSyncBufferedWriterCloser wraps bwc, which must not be used directly
+// afterwards. Close it to stop the background Goroutine.
+func NewSyncBufferedWriterCloser(bwc *BufferedWriterCloser, threshold int, interval time.Duration) *SyncBufferedWriterCloser {
+	if threshold <= 0 {
+		threshold = bwc.chunkSize
+	}
+	s := &SyncBufferedWriterCloser{
+		threshold: threshold,
+		front:     bytes.NewBuffer([]byte{}),
+		back:      bwc,
+		kickCh:    make(chan struct{}, 1),
+		doneCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+	s.room = sync.NewCond(&s.mu)
+	go s.run(interval)
+	return s
+}
+
+func (s *SyncBufferedWriterCloser) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.front.Len() >= FrontLimit*s.threshold && !s.closed && s.err == nil {
+		s.kick()
+		s.room.Wait()
+	}
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, _ := s.front.Write(data)
+	if s.front.Len() >= s.threshold {
+		s.kick()
+	}
+	return n, nil
+}
+
+func (s *SyncBufferedWriterCloser) kick() {
+	// one pending kick is enough, the flusher takes everything
+	select {
+	case s.kickCh <- struct{}{}:
+	default:
+	}
+}
+
+// Flush writes everything written so far downstream, complete chunk or not.
+func (s *SyncBufferedWriterCloser) Flush() error {
+	return s.flush(true)
+}
+
+// Close stops the background Goroutine, flushes and closes the downstream
+// Writer, returning the first error any of that ran into.
+func (s *SyncBufferedWriterCloser) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.room.Broadcast()
+	s.mu.Unlock()
+
+	close(s.doneCh)
+	<-s.stoppedCh
+	s.flush(true)
+
+	s.flushMu.Lock()
+	err := s.back.Close()
+	s.flushMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+func (s *SyncBufferedWriterCloser) run(interval time.Duration) {
+	defer close(s.stoppedCh)
+	// a nil channel blocks forever, so without an interval only kicks flush
+	var tickCh <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+	for {
+		select {
+		case <-s.kickCh:
+			s.flush(false)
+		case <-tickCh:
+			s.flush(true)
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+/* flush moves the front buffer into back. Writers only wait for the swap,
+ * not for the downstream Writer. With all set, back's incomplete chunk
+ * goes out too.
+ */
+func (s *SyncBufferedWriterCloser) flush(all bool) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if s.err != nil {
+		err := s.err
+		s.mu.Unlock()
+		return err
+	}
+	pending := s.front
+	s.front = bytes.NewBuffer(make([]byte, 0, pending.Cap()))
+	s.room.Broadcast()
+	s.mu.Unlock()
+
+	_, err := s.back.Write(pending.Bytes())
+	if err == nil && all {
+		err = s.back.Flush()
+	}
+	if err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.room.Broadcast()
+		s.mu.Unlock()
+	}
+	return err
+}
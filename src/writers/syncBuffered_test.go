@@ -0,0 +1,55 @@
+package writers
+
+import (
+	"testing"
+	"time"
+)
+
+// gatedWriter blocks every Write until gate is closed.
+type gatedWriter struct {
+	gate chan struct{}
+}
+
+func (gw gatedWriter) Write(data []byte) (int, error) {
+	<-gw.gate
+	return len(data), nil
+}
+
+func TestSyncBufferedFrontLimit(t *testing.T) {
+	gw := gatedWriter{gate: make(chan struct{})}
+	const threshold = 16
+	s := NewSyncBufferedWriterCloser(NewBufferedWriterCloser(gw, threshold, FixedBytes), threshold, 0)
+
+	wrote := make(chan int)
+	go func() {
+		n := 0
+		for i := 0; i < 100; i++ {
+			if _, err := s.Write(make([]byte, threshold)); err != nil {
+				t.Error(err)
+			}
+			n++
+			wrote <- n
+		}
+		close(wrote)
+	}()
+
+	// the flusher is stuck downstream with one batch, front fills to the limit
+	n := 0
+	for stalled := false; !stalled; {
+		select {
+		case n = <-wrote:
+		case <-time.After(200 * time.Millisecond):
+			stalled = true
+		}
+	}
+	if n > 2*FrontLimit {
+		t.Errorf("%d writes of threshold bytes went through a stuck downstream", n)
+	}
+
+	close(gw.gate)
+	for range wrote {
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+/* Package writers grows the Writer/Closer/WriterCloser composition from
+ * interfaces.go into WriterClosers meant to be stacked in front of each
+ * other, e.g. buffering in front of a socket.
+ *
+ * The interfaces have exactly the method sets of io.Writer, io.Closer and
+ * io.WriteCloser, so values satisfy both sides without conversion.
+ */
+package writers
+
+import "fmt"
+
+type Writer interface {
+	Write([]byte) (int, error)
+}
+
+type Closer interface {
+	Close() error
+}
+
+type WriterCloser interface {
+	Writer
+	Closer
+}
+
+// ConsoleWriter prints each Write on its own line.
+type ConsoleWriter struct{}
+
+func (cw ConsoleWriter) Write(data []byte) (int, error) {
+	n, err := fmt.Println(string(data))
+	return n, err
+}
+
+// closeIfCloser closes w if it's also a Closer, like a file or a socket.
+func closeIfCloser(w Writer) error {
+	if c, ok := w.(Closer); ok {
+		return c.Close()
+	}
+	return nil
+}